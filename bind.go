@@ -0,0 +1,164 @@
+package gtw
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+var (
+	_httpCtxType  = reflect.TypeOf((*HttpCtx)(nil))
+	_statusType   = reflect.TypeOf(Status(0))
+	_responseType = reflect.TypeOf(Response(nil))
+	_errorType    = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// typedHandler adapts methods shaped `func(*HttpCtx, *In) (Status, Out)` or
+// `func(*HttpCtx, *In) (Out, error)`. In is bound from the request before the
+// method runs and Out is encoded as the response body, in the media type
+// negotiated from the Accept header, unless it already is a Response.
+// `func(*HttpCtx, *In) (Status, error)` is rejected since it is unclear whether
+// the error is meant to be mapped or encoded.
+func (srv *Server) typedHandler(method reflect.Value) (Handler, bool) {
+	t := method.Type()
+	if t.NumIn() != 2 || t.In(0) != _httpCtxType || t.In(1).Kind() != reflect.Pointer || t.In(1).Elem().Kind() != reflect.Struct || t.NumOut() != 2 {
+		return nil, false
+	}
+	withStatus := t.Out(0) == _statusType
+	withError := t.Out(1) == _errorType
+	if withStatus == withError {
+		return nil, false
+	}
+	input := t.In(1).Elem()
+	return func(httpCtx *HttpCtx) (Status, Response) {
+		in := reflect.New(input)
+		if err := bind(httpCtx, in); err != nil {
+			var validationErrors ValidationErrors
+			if errors.As(err, &validationErrors) {
+				return srv.errorMapper(httpCtx, err)
+			}
+			var problem *ProblemDetails
+			if errors.As(err, &problem) {
+				return problem.Status, failure(problem)
+			}
+			return http.StatusBadRequest, failure(NewProblem(http.StatusBadRequest, err.Error()))
+		}
+		out := method.Call([]reflect.Value{reflect.ValueOf(httpCtx), in})
+		if withStatus {
+			return int(out[0].Int()), encode(out[1])
+		}
+		if err, _ := out[1].Interface().(error); err != nil {
+			return srv.errorMapper(httpCtx, err)
+		}
+		return http.StatusOK, encode(out[0])
+	}, true
+}
+
+func encode(value reflect.Value) Response {
+	if value.Type() == _responseType {
+		return value.Interface().(Response)
+	}
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		if value.IsNil() {
+			return Empty()
+		}
+	}
+	return Negotiate(value.Interface())
+}
+
+// bind populates the struct in points to. The request body, when present, is
+// decoded into the field tagged `body` or into the whole struct otherwise.
+// Fields tagged `path`, `query`, `header` or `cookie` are then bound from the
+// matching part of the request and the result is validated.
+func bind(httpCtx *HttpCtx, in reflect.Value) error {
+	t := in.Type().Elem()
+	r := (*http.Request)(httpCtx.Request.Reader)
+	query := Query(r.URL.Query())
+	target := in
+	data := make(map[int]any)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if _, ok := field.Tag.Lookup("body"); ok {
+			target = in.Elem().Field(i).Addr()
+			continue
+		}
+		if name, ok := field.Tag.Lookup("path"); ok {
+			if value, ok := httpCtx.Request.RouteValues[name]; ok {
+				data[i] = value
+			}
+			continue
+		}
+		if name, ok := field.Tag.Lookup("query"); ok {
+			value, ok, err := query.value(field, name)
+			if err != nil {
+				return err
+			}
+			if ok {
+				data[i] = value
+			}
+			continue
+		}
+		if name, ok := field.Tag.Lookup("header"); ok {
+			if values := r.Header.Values(name); len(values) != 0 {
+				data[i] = valuesOf(field, values)
+			}
+			continue
+		}
+		if name, ok := field.Tag.Lookup("cookie"); ok {
+			if cookie, err := r.Cookie(name); err == nil {
+				data[i] = cookie.Value
+			}
+			continue
+		}
+	}
+	if hasBody(r) {
+		if err := httpCtx.Request.decode(target.Interface()); err != nil {
+			return err
+		}
+		if target == in {
+			resetSourced(in.Elem())
+		}
+	}
+	for i, raw := range data {
+		output, err := convert(t.Field(i).Type, raw)
+		if err != nil {
+			return fmt.Errorf("invalid value for `%s`: %w", t.Field(i).Name, err)
+		}
+		in.Elem().Field(i).Set(output)
+	}
+	return Validate(in.Interface())
+}
+
+// resetSourced clears the path, query, header and cookie fields of a struct
+// that was decoded from the body as a whole, so that the body cannot supply
+// values that are meant to come from the request itself.
+func resetSourced(value reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		for _, source := range []string{"path", "query", "header", "cookie"} {
+			if _, ok := value.Type().Field(i).Tag.Lookup(source); ok && value.Field(i).CanSet() {
+				value.Field(i).SetZero()
+				break
+			}
+		}
+	}
+}
+
+func valuesOf(field reflect.StructField, values []string) any {
+	if field.Type.Kind() != reflect.Slice {
+		return values[0]
+	}
+	output := make([]any, len(values))
+	for i, value := range values {
+		output[i] = value
+	}
+	return output
+}
+
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
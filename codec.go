@@ -0,0 +1,155 @@
+package gtw
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+type (
+	// Codec converts values to and from the wire format of a media type.
+	// Codecs are registered on a Server with Server.Codec and are used both to
+	// decode request bodies, selected by the Content-Type header, and to encode
+	// responses written with Encode, JSON or XML.
+	//
+	// A MessagePack or CBOR codec only needs to wrap the Marshal and Unmarshal
+	// functions of its library:
+	//
+	//	type msgpackCodec struct{}
+	//
+	//	func (msgpackCodec) Marshal(v any) ([]byte, error)      { return msgpack.Marshal(v) }
+	//	func (msgpackCodec) Unmarshal(data []byte, v any) error { return msgpack.Unmarshal(data, v) }
+	//
+	//	server.Codec("application/msgpack", msgpackCodec{})
+	//
+	// Codecs must be safe for concurrent use.
+	Codec interface {
+		Marshal(v any) ([]byte, error)
+		Unmarshal(data []byte, v any) error
+	}
+	codecs    map[string]Codec
+	jsonCodec struct{}
+	xmlCodec  struct{}
+	scope     struct {
+		server   *Server
+		endpoint *endpoint
+	}
+	scopeKey struct{}
+)
+
+var (
+	_codecs = defaultCodecs()
+)
+
+func defaultCodecs() codecs {
+	return codecs{
+		"application/json": jsonCodec{},
+		"application/xml":  xmlCodec{},
+		"text/xml":         xmlCodec{},
+	}
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (xmlCodec) Marshal(v any) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (xmlCodec) Unmarshal(data []byte, v any) error {
+	return xml.Unmarshal(data, v)
+}
+
+// Codec registers codec for mediaType, replacing any codec registered for it
+// before, including the built-in `application/json`, `application/xml` and
+// `text/xml` codecs. Media types with a structured syntax suffix such as
+// `application/vnd.api+json` fall back to the codec of `application/json`.
+func (srv *Server) Codec(mediaType string, codec Codec) *Server {
+	srv.codecs[strings.ToLower(mediaType)] = codec
+	return srv
+}
+
+func (codecs codecs) lookup(mediaType string) (Codec, bool) {
+	if codec, ok := codecs[mediaType]; ok {
+		return codec, true
+	}
+	if index := strings.LastIndexByte(mediaType, '+'); index >= 0 {
+		codec, ok := codecs[fmt.Sprintf("application/%s", mediaType[index+1:])]
+		return codec, ok
+	}
+	return nil, false
+}
+
+func withScope(r *http.Request, server *Server, endpoint *endpoint) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), scopeKey{}, &scope{server: server, endpoint: endpoint}))
+}
+
+func scopeOf(r *http.Request) *scope {
+	if scope, ok := r.Context().Value(scopeKey{}).(*scope); ok {
+		return scope
+	}
+	return &scope{}
+}
+
+func (scope *scope) codecs() codecs {
+	if scope.server == nil {
+		return _codecs
+	}
+	return scope.server.codecs
+}
+
+func (scope *scope) limits() *limits {
+	if scope.endpoint == nil || scope.endpoint.limits == nil {
+		return _defaultLimits
+	}
+	return scope.endpoint.limits
+}
+
+// codecsOf returns the codecs of the server that owns w, if any.
+func codecsOf(w http.ResponseWriter) codecs {
+	if writer, ok := unwrap(w); ok {
+		return writer.server.codecs
+	}
+	return _codecs
+}
+
+// Encode writes v encoded by the codec registered for mediaType, which is
+// also sent as the Content-Type.
+func Encode(mediaType string, v any) func(status int, w http.ResponseWriter) {
+	return func(status int, w http.ResponseWriter) {
+		codec, ok := codecsOf(w).lookup(mediaType)
+		if !ok {
+			writeError(w, NewProblem(http.StatusInternalServerError, fmt.Sprintf("no codec registered for `%s`", mediaType)))
+			return
+		}
+		data, _err := codec.Marshal(v)
+		if _err != nil {
+			writeError(w, NewProblem(http.StatusInternalServerError, _err.Error()))
+			return
+		}
+		w.Header().Add("Content-Type", mediaType)
+		w.WriteHeader(status)
+		w.Write(data)
+	}
+}
+
+func XML(v any) func(status int, w http.ResponseWriter) {
+	return Encode("application/xml", v)
+}
+
+func mediaTypeOf(header http.Header) string {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
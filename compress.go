@@ -0,0 +1,246 @@
+package gtw
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	compressor interface {
+		io.WriteCloser
+		Flush() error
+		Reset(w io.Writer)
+	}
+	// compressWriter buffers the start of a response until minSize bytes were
+	// written, the response is flushed or it ends, and only then decides
+	// whether to compress it.
+	compressWriter struct {
+		http.ResponseWriter
+		encoding string
+		minSize  int
+		status   int
+		buffer   []byte
+		writer   compressor
+		decided  bool
+	}
+)
+
+var (
+	_compressors = map[string]*sync.Pool{
+		"gzip": {New: func() any {
+			return gzip.NewWriter(nil)
+		}},
+		"deflate": {New: func() any {
+			writer, _ := flate.NewWriter(nil, flate.DefaultCompression)
+			return writer
+		}},
+	}
+	_incompressible = []string{
+		"image/", "video/", "audio/", "font/woff",
+		"application/zip", "application/gzip", "application/x-gzip", "application/x-brotli",
+		"application/x-7z-compressed", "application/x-rar-compressed", "application/pdf", "application/wasm",
+	}
+)
+
+// Compress returns middleware that gzip or deflate encodes responses
+// according to the Accept-Encoding header of the request. Bodies shorter
+// than minSize bytes, already encoded bodies, partial content and media
+// that is compressed already, such as images, are sent as they are.
+// Flushing responses like Stream, NDJSON and SSE are compressed and flushed
+// incrementally. Routes tagged `compress:"off"` are never compressed.
+func Compress(minSize int) Middleware {
+	return func(next Handler) Handler {
+		return func(httpCtx *HttpCtx) (Status, Response) {
+			status, response := next(httpCtx)
+			r := (*http.Request)(httpCtx.Request.Reader)
+			if endpoint := scopeOf(r).endpoint; endpoint != nil && endpoint.uncompressed {
+				return status, response
+			}
+			encoding := encodingOf(r.Header.Get("Accept-Encoding"))
+			return status, func(status int, w http.ResponseWriter) {
+				addVary(w.Header(), "Accept-Encoding")
+				if len(encoding) == 0 || r.Method == http.MethodHead {
+					response(status, w)
+					return
+				}
+				writer := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+				response(status, writer)
+				writer.close()
+			}
+		}
+	}
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if status < http.StatusOK {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buffer = append(w.buffer, b...)
+		if len(w.buffer) < w.minSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.writer != nil {
+		return w.writer.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.decide(true)
+	}
+	if w.writer != nil {
+		w.writer.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide sends the headers and the buffered body, compressed when compress
+// is set and the response qualifies.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.Header()
+	if len(header.Get("Content-Type")) == 0 && len(w.buffer) != 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buffer))
+	}
+	if compress && w.compressible() {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+		w.writer = _compressors[w.encoding].Get().(compressor)
+		w.writer.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buffer := w.buffer
+	w.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+	if w.writer != nil {
+		_, err := w.writer.Write(buffer)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buffer)
+	return err
+}
+
+func (w *compressWriter) compressible() bool {
+	header := w.Header()
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified || w.status == http.StatusPartialContent {
+		return false
+	}
+	if len(header.Get("Content-Encoding")) != 0 || len(header.Get("Content-Range")) != 0 {
+		return false
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < w.minSize {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	if strings.HasPrefix(contentType, "image/svg+xml") {
+		return true
+	}
+	for _, prefix := range _incompressible {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// close sends what is still buffered uncompressed, since it is shorter than
+// minSize, and finishes the compressed stream otherwise. It is not called
+// when the response panics so that the buffered start of the body is dropped
+// and the panic can still be answered with a 500.
+func (w *compressWriter) close() {
+	if !w.decided {
+		if w.status == 0 {
+			return
+		}
+		w.decide(false)
+	}
+	if w.writer != nil {
+		w.writer.Close()
+		_compressors[w.encoding].Put(w.writer)
+		w.writer = nil
+	}
+}
+
+// encodingOf picks gzip or deflate from an Accept-Encoding header, preferring
+// gzip when both are equally acceptable.
+func encodingOf(header string) string {
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{"gzip", "deflate"} {
+		q, specificity := 0.0, -1
+		for _, item := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			rank := 1
+			if name == "*" {
+				rank = 0
+			} else if name != encoding {
+				continue
+			}
+			if rank <= specificity {
+				continue
+			}
+			q, specificity = 1.0, rank
+			if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				q, _ = strconv.ParseFloat(value, 64)
+			}
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+func addVary(header http.Header, value string) {
+	for _, vary := range header.Values("Vary") {
+		for _, item := range strings.Split(vary, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
@@ -0,0 +1,100 @@
+package gtw
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	Constraint func(value string) (any, bool)
+	constraint struct {
+		expr  string
+		match Constraint
+	}
+)
+
+var (
+	_constraints map[string]Constraint
+	_uuid        *regexp.Regexp
+)
+
+func init() {
+	_uuid = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	_constraints = make(map[string]Constraint)
+	_constraints["int"] = func(value string) (any, bool) {
+		output, err := strconv.Atoi(value)
+		return output, err == nil
+	}
+	_constraints["int64"] = func(value string) (any, bool) {
+		output, err := strconv.ParseInt(value, 10, 64)
+		return output, err == nil
+	}
+	_constraints["uint"] = func(value string) (any, bool) {
+		output, err := strconv.ParseUint(value, 10, 0)
+		return uint(output), err == nil
+	}
+	_constraints["uint64"] = func(value string) (any, bool) {
+		output, err := strconv.ParseUint(value, 10, 64)
+		return output, err == nil
+	}
+	_constraints["float"] = func(value string) (any, bool) {
+		output, err := strconv.ParseFloat(value, 64)
+		return output, err == nil
+	}
+	_constraints["bool"] = func(value string) (any, bool) {
+		output, err := strconv.ParseBool(value)
+		return output, err == nil
+	}
+	_constraints["string"] = func(value string) (any, bool) {
+		return value, true
+	}
+	_constraints["uuid"] = func(value string) (any, bool) {
+		return value, _uuid.MatchString(value)
+	}
+}
+
+func (c *constraint) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.expr
+}
+
+// AddConstraint registers a named route parameter constraint that can be
+// referenced as `:name<constraint>` in route tags. Constraints must be
+// registered before the routes that use them.
+func AddConstraint(name string, fn Constraint) {
+	_constraints[name] = fn
+}
+
+// parseParam splits a `name<constraint>` segment. Anything between the angle
+// brackets that is not a registered constraint name is compiled as a regular
+// expression anchored to the whole segment.
+func parseParam(segment string) (string, *constraint, error) {
+	start := strings.IndexByte(segment, '<')
+	if start < 0 {
+		return segment, nil, nil
+	}
+	if !strings.HasSuffix(segment, ">") {
+		return "", nil, fmt.Errorf("unterminated constraint in `%s`", segment)
+	}
+	name, expr := segment[:start], segment[start+1:len(segment)-1]
+	if len(expr) == 0 {
+		return "", nil, fmt.Errorf("empty constraint in `%s`", segment)
+	}
+	if fn, ok := _constraints[expr]; ok {
+		return name, &constraint{expr: expr, match: fn}, nil
+	}
+	regex, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", expr))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid constraint in `%s`: %w", segment, err)
+	}
+	return name, &constraint{
+		expr: expr,
+		match: func(value string) (any, bool) {
+			return value, regex.MatchString(value)
+		},
+	}, nil
+}
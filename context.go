@@ -0,0 +1,71 @@
+package gtw
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+var (
+	_ context.Context = (*HttpCtx)(nil)
+)
+
+// Context returns the context of the underlying request. It carries the
+// deadline configured through the `timeout` tag and is cancelled when the
+// client goes away.
+func (httpCtx *HttpCtx) Context() context.Context {
+	return (*http.Request)(httpCtx.Request.Reader).Context()
+}
+
+func (httpCtx *HttpCtx) Deadline() (deadline time.Time, ok bool) {
+	return httpCtx.Context().Deadline()
+}
+
+func (httpCtx *HttpCtx) Done() <-chan struct{} {
+	return httpCtx.Context().Done()
+}
+
+func (httpCtx *HttpCtx) Err() error {
+	return httpCtx.Context().Err()
+}
+
+// Value resolves string keys from the request scoped storage first and falls
+// back to the request context for everything else.
+func (httpCtx *HttpCtx) Value(key any) any {
+	if key, ok := key.(string); ok {
+		if value, ok := httpCtx.Get(key); ok {
+			return value
+		}
+	}
+	return httpCtx.Context().Value(key)
+}
+
+// Set stores a request scoped value, typically from a middleware, for later
+// retrieval with Get or GetValue.
+func (httpCtx *HttpCtx) Set(key string, value any) {
+	httpCtx.mut.Lock()
+	defer httpCtx.mut.Unlock()
+	if httpCtx.values == nil {
+		httpCtx.values = make(map[string]any)
+	}
+	httpCtx.values[key] = value
+}
+
+func (httpCtx *HttpCtx) Get(key string) (any, bool) {
+	httpCtx.mut.Lock()
+	defer httpCtx.mut.Unlock()
+	value, ok := httpCtx.values[key]
+	return value, ok
+}
+
+// GetValue returns the request scoped value stored under key when it exists
+// and is of type T.
+func GetValue[T any](httpCtx *HttpCtx, key string) (T, bool) {
+	value, ok := httpCtx.Get(key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	output, ok := value.(T)
+	return output, ok
+}
@@ -0,0 +1,67 @@
+package gtw
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type (
+	// ErrorMapper translates an error returned by a handler into a response.
+	ErrorMapper func(httpCtx *HttpCtx, err error) (Status, Response)
+)
+
+func (httpError *HttpError) Error() string {
+	return fmt.Sprintf("%d %s: %v", httpError.Status, http.StatusText(httpError.Status), httpError.Message)
+}
+
+// MapError replaces the mapper used for errors returned by handlers shaped
+// `func(*HttpCtx) (Response, error)` or `func(*HttpCtx) error`.
+func (srv *Server) MapError(errorMapper ErrorMapper) *Server {
+	srv.errorMapper = errorMapper
+	return srv
+}
+
+// defaultErrorMapper unwraps *ProblemDetails, ValidationErrors and *HttpError
+// values and responds with their status and message. Any other error is
+// reported as a 500 without exposing it.
+func (srv *Server) defaultErrorMapper(httpCtx *HttpCtx, err error) (Status, Response) {
+	var problem *ProblemDetails
+	if errors.As(err, &problem) {
+		return problem.Status, Problem(problem)
+	}
+	var validationErrors ValidationErrors
+	if errors.As(err, &validationErrors) {
+		if srv.problems {
+			return http.StatusUnprocessableEntity, Problem(NewProblem(http.StatusUnprocessableEntity, "validation failed").With("errors", validationErrors))
+		}
+		return http.StatusUnprocessableEntity, JSON(map[string]any{
+			"status":  http.StatusUnprocessableEntity,
+			"message": "validation failed",
+			"errors":  validationErrors,
+		})
+	}
+	var httpError *HttpError
+	if !errors.As(err, &httpError) {
+		if srv.problems {
+			return http.StatusInternalServerError, Problem(NewProblem(http.StatusInternalServerError, ""))
+		}
+		httpError = &HttpError{
+			Status:  http.StatusInternalServerError,
+			Message: http.StatusText(http.StatusInternalServerError),
+		}
+	}
+	if srv.problems {
+		problem := NewProblem(httpError.Status, "")
+		if message, ok := httpError.Message.(string); ok {
+			problem.Detail = message
+		} else {
+			problem.With("message", httpError.Message)
+		}
+		return problem.Status, Problem(problem)
+	}
+	return httpError.Status, JSON(map[string]any{
+		"status":  httpError.Status,
+		"message": httpError.Message,
+	})
+}
@@ -0,0 +1,268 @@
+package gtw
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type (
+	// FileHandler consumes a streamed multipart file part. Only the Filename
+	// and Header of the file header are populated.
+	FileHandler func(header *multipart.FileHeader, r io.Reader) error
+	limits      struct {
+		memory int64
+		parts  int
+		file   int64
+	}
+)
+
+var (
+	_fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	_fileHeadersType = reflect.TypeOf(([]*multipart.FileHeader)(nil))
+	_fileHandlerType = reflect.TypeOf(FileHandler(nil))
+	_defaultLimits   = &limits{memory: 32 << 20}
+	_partOverhead    = int64(4 << 10)
+)
+
+// limitsOf reads the `multipart` tag of a route, e.g.
+// `multipart:"memory=8MB,parts=20,file=4MB"`. Memory bounds the form values
+// held in memory, parts the number of form parts and file the size of each
+// file. Zero parts or file sizes are unlimited.
+func limitsOf(field reflect.StructField) (*limits, error) {
+	tag, ok := field.Tag.Lookup("multipart")
+	if !ok {
+		return nil, nil
+	}
+	limits := *_defaultLimits
+	for _, item := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+		switch key {
+		case "memory", "file":
+			size, err := parseSize(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid multipart limit `%s`: %w", item, err)
+			}
+			if key == "memory" {
+				limits.memory = size
+				continue
+			}
+			limits.file = size
+		case "parts":
+			parts, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid multipart limit `%s`: %w", item, err)
+			}
+			limits.parts = parts
+		default:
+			return nil, fmt.Errorf("unknown multipart limit `%s`", item)
+		}
+	}
+	return &limits, nil
+}
+
+func parseSize(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	for _, unit := range units {
+		if number, ok := strings.CutSuffix(strings.ToUpper(value), unit.suffix); ok {
+			size, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+			return size * unit.size, err
+		}
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// decodeForm binds an `application/x-www-form-urlencoded` body into v.
+func (r *Reader) decodeForm(v any) error {
+	request := (*http.Request)(r)
+	request.Body = http.MaxBytesReader(nil, request.Body, scopeOf(request).limits().memory)
+	if err := request.ParseForm(); err != nil {
+		return tooLarge(err)
+	}
+	return Query(request.PostForm).bind(v, "form")
+}
+
+// decodeMultipart binds a `multipart/form-data` body into v. Form values are
+// bound through `form` tags and files through `file` tags. When v declares
+// *multipart.FileHeader or []*multipart.FileHeader fields the form is read
+// up front, spilling large files to disk; otherwise parts are streamed and
+// files are handed to the FileHandler fields of v as they arrive. A file
+// part without a handler is rejected, so typed handlers, whose input starts
+// out empty, should declare *multipart.FileHeader fields instead.
+func (r *Reader) decodeMultipart(v any) error {
+	request := (*http.Request)(r)
+	limits := scopeOf(request).limits()
+	if limits.parts > 0 && limits.file > 0 {
+		request.Body = http.MaxBytesReader(nil, request.Body, limits.memory+int64(limits.parts)*(limits.file+_partOverhead))
+	}
+	reader, err := request.MultipartReader()
+	if err != nil {
+		return err
+	}
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected a pointer to a struct but found %T", v)
+	}
+	if hasFileHeaders(value.Elem().Type()) {
+		return r.readForm(reader, limits, value.Elem())
+	}
+	return r.streamForm(reader, limits, value.Elem())
+}
+
+// readForm copies the parts that stay within limits into a
+// multipart.Reader.ReadForm running on the other end of a pipe, so that the
+// limits are enforced before the rest of the body is read or spooled.
+func (r *Reader) readForm(reader *multipart.Reader, limits *limits, value reflect.Value) error {
+	request := (*http.Request)(r)
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	var form *multipart.Form
+	var readErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		form, readErr = multipart.NewReader(pr, writer.Boundary()).ReadForm(limits.memory)
+		pr.CloseWithError(readErr)
+	}()
+	err := eachPart(reader, limits, func(part *multipart.Part, data io.Reader) error {
+		target, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(target, data)
+		return err
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	pw.CloseWithError(err)
+	<-done
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		if form != nil {
+			form.RemoveAll()
+		}
+		if errors.Is(err, multipart.ErrMessageTooLarge) {
+			return NewProblem(http.StatusRequestEntityTooLarge, "multipart form exceeds the memory limit")
+		}
+		return err
+	}
+	request.MultipartForm = form
+	if err := Query(form.Value).bind(value.Addr().Interface(), "form"); err != nil {
+		return err
+	}
+	for i := 0; i < value.NumField(); i++ {
+		name, ok := value.Type().Field(i).Tag.Lookup("file")
+		if !ok || len(form.File[name]) == 0 {
+			continue
+		}
+		switch value.Field(i).Type() {
+		case _fileHeaderType:
+			value.Field(i).Set(reflect.ValueOf(form.File[name][0]))
+		case _fileHeadersType:
+			value.Field(i).Set(reflect.ValueOf(form.File[name]))
+		}
+	}
+	return nil
+}
+
+func (r *Reader) streamForm(reader *multipart.Reader, limits *limits, value reflect.Value) error {
+	handlers := make(map[string]FileHandler)
+	for i := 0; i < value.NumField(); i++ {
+		name, ok := value.Type().Field(i).Tag.Lookup("file")
+		if ok && value.Field(i).Type() == _fileHandlerType && !value.Field(i).IsNil() {
+			handlers[name] = value.Field(i).Interface().(FileHandler)
+		}
+	}
+	values := make(url.Values)
+	err := eachPart(reader, limits, func(part *multipart.Part, data io.Reader) error {
+		if len(part.FileName()) == 0 {
+			value, err := io.ReadAll(data)
+			values.Add(part.FormName(), string(value))
+			return err
+		}
+		handler, ok := handlers[part.FormName()]
+		if !ok {
+			return NewProblem(http.StatusBadRequest, fmt.Sprintf("no handler for file `%s`", part.FormName()))
+		}
+		return handler(&multipart.FileHeader{Filename: part.FileName(), Header: part.Header}, data)
+	})
+	if err != nil {
+		return err
+	}
+	return Query(values).bind(value.Addr().Interface(), "form")
+}
+
+// eachPart hands every part of reader to fn while enforcing limits: values
+// are read into memory up to the memory limit, files are cut off at the file
+// limit and the number of parts is capped. Whatever fn leaves of a file is
+// drained before the next part is read.
+func eachPart(reader *multipart.Reader, limits *limits, fn func(part *multipart.Part, data io.Reader) error) error {
+	memory := limits.memory
+	for parts := 1; ; parts++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return tooLarge(err)
+		}
+		if limits.parts > 0 && parts > limits.parts {
+			return NewProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("multipart form exceeds the limit of %d parts", limits.parts))
+		}
+		if len(part.FileName()) == 0 {
+			data, err := io.ReadAll(io.LimitReader(part, memory+1))
+			if err != nil {
+				return tooLarge(err)
+			}
+			if memory -= int64(len(data)); memory < 0 {
+				return NewProblem(http.StatusRequestEntityTooLarge, "multipart form exceeds the memory limit")
+			}
+			if err := fn(part, bytes.NewReader(data)); err != nil {
+				return err
+			}
+			continue
+		}
+		var file io.Reader = part
+		if limits.file > 0 {
+			file = http.MaxBytesReader(nil, io.NopCloser(part), limits.file)
+		}
+		if err := fn(part, file); err != nil {
+			return tooLarge(err)
+		}
+		if _, err := io.Copy(io.Discard, file); err != nil {
+			return tooLarge(err)
+		}
+	}
+}
+
+func hasFileHeaders(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup("file"); ok && (field.Type == _fileHeaderType || field.Type == _fileHeadersType) {
+			return true
+		}
+	}
+	return false
+}
+
+// tooLarge reports errors raised by an exhausted http.MaxBytesReader as 413s.
+func tooLarge(err error) error {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return NewProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds the limit of %d bytes", maxBytesError.Limit))
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package gtw
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+type (
+	// Templates configures the html/template set rendered by HTML. Every
+	// `.html` file of FS that is neither a layout nor a partial is a page,
+	// named by its path, e.g. `users/show.html`. Each page is parsed together
+	// with all layouts and partials, which are also named by their path, so a
+	// page typically defines the blocks of a layout and then invokes it:
+	//
+	//	{{define "content"}}<h1>{{.Name}}</h1>{{end}}
+	//	{{template "layouts/base.html" .}}
+	//
+	// Layouts and Partials are path.Match patterns and default to
+	// `layouts/*.html` and `partials/*.html`. When Reload is set the templates
+	// are parsed again on every render so that edits show up without a
+	// restart; it is meant for development with an os.DirFS.
+	Templates struct {
+		FS       fs.FS
+		Layouts  string
+		Partials string
+		Funcs    template.FuncMap
+		Reload   bool
+	}
+	templateSet struct {
+		config *Templates
+		pages  map[string]*template.Template
+		mut    sync.RWMutex
+	}
+)
+
+// Templates loads the template set used by HTML responses of the server.
+func (srv *Server) Templates(templates *Templates) error {
+	config := *templates
+	if len(config.Layouts) == 0 {
+		config.Layouts = "layouts/*.html"
+	}
+	if len(config.Partials) == 0 {
+		config.Partials = "partials/*.html"
+	}
+	set := &templateSet{config: &config}
+	if err := set.load(); err != nil {
+		return err
+	}
+	srv.templates = set
+	return nil
+}
+
+// HTML renders the page template name with data. The page is rendered into a
+// buffer first so that template errors are reported as a 500 instead of a
+// truncated page.
+func HTML(name string, data any) func(status int, w http.ResponseWriter) {
+	return func(status int, w http.ResponseWriter) {
+		writer, ok := unwrap(w)
+		if !ok || writer.server.templates == nil {
+			writeError(w, NewProblem(http.StatusInternalServerError, "no templates loaded"))
+			return
+		}
+		page, err := writer.server.templates.lookup(name)
+		if err != nil {
+			writeError(w, NewProblem(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		buffer := new(bytes.Buffer)
+		if err := page.Execute(buffer, data); err != nil {
+			writeError(w, NewProblem(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write(buffer.Bytes())
+	}
+}
+
+func (set *templateSet) lookup(name string) (*template.Template, error) {
+	if set.config.Reload {
+		if err := set.load(); err != nil {
+			return nil, err
+		}
+	}
+	set.mut.RLock()
+	defer set.mut.RUnlock()
+	page, ok := set.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("template `%s` not found", name)
+	}
+	return page, nil
+}
+
+func (set *templateSet) load() error {
+	base := template.New("").Funcs(set.config.Funcs)
+	pages := make([]string, 0)
+	err := fs.WalkDir(set.config.FS, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(name, ".html") {
+			return err
+		}
+		if !set.shared(name) {
+			pages = append(pages, name)
+			return nil
+		}
+		return parseTemplate(base, set.config.FS, name)
+	})
+	if err != nil {
+		return err
+	}
+	output := make(map[string]*template.Template, len(pages))
+	for _, name := range pages {
+		page, err := base.Clone()
+		if err != nil {
+			return err
+		}
+		if err := parseTemplate(page, set.config.FS, name); err != nil {
+			return err
+		}
+		output[name] = page.Lookup(name)
+	}
+	set.mut.Lock()
+	defer set.mut.Unlock()
+	set.pages = output
+	return nil
+}
+
+// shared reports whether name is a layout or a partial.
+func (set *templateSet) shared(name string) bool {
+	for _, pattern := range []string{set.config.Layouts, set.config.Partials} {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTemplate(t *template.Template, fsys fs.FS, name string) error {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	if _, err := t.New(name).Parse(string(data)); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package di
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	_disposed sync.Map
+)
+
+type disposer interface {
+	dispose() error
+}
+
+func (s *singleton[T]) dispose() error {
+	s.mut.Lock()
+	created, value := s.created, s.instance
+	s.mut.Unlock()
+	if !created || value == nil {
+		return nil
+	}
+	switch instance := any(value).(type) {
+	case interface{ Dispose() error }:
+		return instance.Dispose()
+	case io.Closer:
+		return instance.Close()
+	}
+	return nil
+}
+
+// Dispose releases every singleton that has been created and implements
+// either `Dispose() error` or io.Closer. Singletons are registered process
+// wide, so this releases the singletons of every server in the process, not
+// only those of the server being shut down. Each singleton is released at
+// most once; singletons still being created are skipped.
+func Dispose() error {
+	errs := make([]error, 0)
+	_context.Range(func(key, value any) bool {
+		if value, ok := value.(disposer); ok {
+			if _, loaded := _disposed.LoadOrStore(value, true); loaded {
+				return true
+			}
+			if err := value.dispose(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return true
+	})
+	return errors.Join(errs...)
+}
@@ -45,11 +45,14 @@ type singleton[T any] struct {
 	instance *T
 	err      error
 	once     sync.Once
+	mut      sync.Mutex
 }
 
 func (s *singleton[T]) getInstance() (instance *T, err error) {
 	s.once.Do(func() {
 		value, err := s.ig()
+		s.mut.Lock()
+		defer s.mut.Unlock()
 		s.instance = value
 		s.err = err
 		s.created = true
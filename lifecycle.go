@@ -0,0 +1,150 @@
+package gtw
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vedadiyan/gtw/internal/di"
+)
+
+type (
+	ShutdownHook func(ctx context.Context) error
+	lifecycle    struct {
+		server   *http.Server
+		active   sync.WaitGroup
+		sockets  map[*websocket.Conn]struct{}
+		hooks    []ShutdownHook
+		closing  bool
+		stopping chan struct{}
+		mut      sync.Mutex
+		once     sync.Once
+	}
+)
+
+// OnShutdown registers a hook that runs during Shutdown once in-flight
+// requests have drained. Hooks run in reverse order of registration, before
+// DI singletons are disposed.
+func (srv *Server) OnShutdown(hook ShutdownHook) *Server {
+	srv.lifecycle.mut.Lock()
+	defer srv.lifecycle.mut.Unlock()
+	srv.lifecycle.hooks = append(srv.lifecycle.hooks, hook)
+	return srv
+}
+
+// Run serves on server until the process receives SIGINT or SIGTERM and then
+// shuts down gracefully, giving in-flight work up to timeout to complete.
+func (srv *Server) Run(server *http.Server, timeout time.Duration) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe(server)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-signals:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+// Shutdown ends open event streams, stops accepting new connections, waits
+// for in-flight requests, closes WebSocket connections opened through
+// HttpCtx.Upgrade whose handlers are still running, and finally runs the
+// shutdown hooks and disposes DI singletons. Requests arriving once Shutdown
+// has started are answered with 503. Waiting is bounded by ctx; the hooks run
+// regardless. DI singletons are shared by the whole process, so shutting down
+// one of several servers disposes them for all of them.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	errs := make([]error, 0)
+	srv.lifecycle.once.Do(func() {
+		srv.lifecycle.mut.Lock()
+		close(srv.lifecycle.stopping)
+		server := srv.lifecycle.server
+		srv.lifecycle.mut.Unlock()
+		if server != nil {
+			if err := server.Shutdown(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		srv.closeSockets()
+		done := make(chan struct{})
+		go func() {
+			srv.lifecycle.active.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			errs = append(errs, ctx.Err())
+		}
+		srv.lifecycle.mut.Lock()
+		hooks := srv.lifecycle.hooks
+		srv.lifecycle.mut.Unlock()
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if err := hooks[i](ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := di.Dispose(); err != nil {
+			errs = append(errs, err)
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// enter counts a request as in flight unless Shutdown has started, in which
+// case it reports false.
+func (srv *Server) enter() bool {
+	srv.lifecycle.mut.Lock()
+	defer srv.lifecycle.mut.Unlock()
+	select {
+	case <-srv.lifecycle.stopping:
+		return false
+	default:
+	}
+	srv.lifecycle.active.Add(1)
+	return true
+}
+
+func (srv *Server) track(conn *websocket.Conn) {
+	srv.lifecycle.mut.Lock()
+	defer srv.lifecycle.mut.Unlock()
+	if srv.lifecycle.closing {
+		closeSocket(conn)
+		return
+	}
+	srv.lifecycle.sockets[conn] = struct{}{}
+}
+
+func (srv *Server) untrack(conn *websocket.Conn) {
+	srv.lifecycle.mut.Lock()
+	defer srv.lifecycle.mut.Unlock()
+	delete(srv.lifecycle.sockets, conn)
+}
+
+func (srv *Server) closeSockets() {
+	srv.lifecycle.mut.Lock()
+	defer srv.lifecycle.mut.Unlock()
+	srv.lifecycle.closing = true
+	for conn := range srv.lifecycle.sockets {
+		closeSocket(conn)
+		delete(srv.lifecycle.sockets, conn)
+	}
+}
+
+func closeSocket(conn *websocket.Conn) {
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	conn.Close()
+}
@@ -0,0 +1,66 @@
+package gtw
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type (
+	// Middleware wraps a Handler. Middleware runs in the following order, from
+	// the outermost to the innermost:
+	//
+	//  1. global middleware added with Server.Use, in the order it was added
+	//  2. group middleware of each enclosing API struct, parents first, where a
+	//     struct contributes the names listed in its Metadata `middleware` tag
+	//     followed by whatever its Middleware() method returns
+	//  3. route middleware listed in the `middleware` tag of the Handler field
+	Middleware func(next Handler) Handler
+)
+
+var (
+	_middlewareProviderType = reflect.TypeOf((*interface{ Middleware() []Middleware })(nil)).Elem()
+)
+
+// Use appends global middleware that wraps every route of the server,
+// including routes registered before Use was called. The middleware chain of
+// a route is built once, when the route is registered or Use is called, so
+// Use should not be called while the server is serving requests.
+func (srv *Server) Use(middleware ...Middleware) *Server {
+	srv.middleware = append(srv.middleware, middleware...)
+	for _, endpoint := range srv.endpoints {
+		endpoint.pipeline = chain(endpoint.handler, srv.middleware)
+	}
+	return srv
+}
+
+// AddMiddleware registers a named middleware that can be referenced from
+// `middleware` tags. Named middleware must be added before the API structs
+// that reference it are registered.
+func (srv *Server) AddMiddleware(name string, middleware Middleware) *Server {
+	srv.namedMiddleware[name] = middleware
+	return srv
+}
+
+func (srv *Server) resolveMiddleware(tag string) ([]Middleware, error) {
+	middleware := make([]Middleware, 0)
+	for _, name := range strings.Split(tag, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		value, ok := srv.namedMiddleware[name]
+		if !ok {
+			return nil, fmt.Errorf("middleware `%s` has not been registered", name)
+		}
+		middleware = append(middleware, value)
+	}
+	return middleware, nil
+}
+
+func chain(handler Handler, middleware []Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
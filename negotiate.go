@@ -0,0 +1,123 @@
+package gtw
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	mediaRange struct {
+		mediaType string
+		q         float64
+	}
+)
+
+// Negotiate writes v with the codec that best matches the Accept header of
+// the request, honouring q-values and `type/*` or `*/*` wildcards. JSON is
+// preferred when the client accepts several media types equally, sends no
+// Accept header or is a browser asking for HTML. Requests that accept none of
+// the registered media types are answered with 406.
+func Negotiate(v any) func(status int, w http.ResponseWriter) {
+	return func(status int, w http.ResponseWriter) {
+		w.Header().Add("Vary", "Accept")
+		codecs, accept := _codecs, ""
+		if writer, ok := unwrap(w); ok {
+			codecs, accept = writer.server.codecs, writer.request.Header.Get("Accept")
+		}
+		mediaType, ok := negotiate(accept, codecs)
+		if !ok {
+			writeError(w, NewProblem(http.StatusNotAcceptable, fmt.Sprintf("none of %s is acceptable", strings.Join(codecs.mediaTypes(), ", "))))
+			return
+		}
+		Encode(mediaType, v)(status, w)
+	}
+}
+
+func negotiate(accept string, codecs codecs) (string, bool) {
+	candidates := codecs.mediaTypes()
+	if len(candidates) == 0 {
+		return "", false
+	}
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 || browser(ranges, codecs) {
+		return candidates[0], true
+	}
+	best, bestQ := "", 0.0
+	for _, candidate := range candidates {
+		q, specificity := 0.0, -1
+		for _, mediaRange := range ranges {
+			if rank, ok := mediaRange.match(candidate); ok && rank > specificity {
+				q, specificity = mediaRange.q, rank
+			}
+		}
+		if q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// browser reports whether ranges ask for an HTML page the server has no codec
+// for, which is what browsers send when a user opens an API URL. Such
+// requests are treated as if they had no Accept header.
+func browser(ranges []mediaRange, codecs codecs) bool {
+	if _, ok := codecs["text/html"]; ok {
+		return false
+	}
+	for _, mediaRange := range ranges {
+		if mediaRange.mediaType == "text/html" && mediaRange.q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAccept(accept string) []mediaRange {
+	ranges := make([]mediaRange, 0)
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// match reports whether mediaType falls in the range and how specific the
+// range is: 0 for `*/*`, 1 for `type/*` and 2 for an exact media type.
+func (mediaRange mediaRange) match(mediaType string) (int, bool) {
+	if mediaRange.mediaType == "*/*" {
+		return 0, true
+	}
+	if kind, ok := strings.CutSuffix(mediaRange.mediaType, "/*"); ok {
+		return 1, strings.HasPrefix(mediaType, kind+"/")
+	}
+	return 2, mediaRange.mediaType == mediaType
+}
+
+// mediaTypes lists the registered media types with `application/json` first
+// and the rest in alphabetical order.
+func (codecs codecs) mediaTypes() []string {
+	mediaTypes := make([]string, 0, len(codecs))
+	for mediaType := range codecs {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Slice(mediaTypes, func(i, j int) bool {
+		if mediaTypes[i] == "application/json" || mediaTypes[j] == "application/json" {
+			return mediaTypes[i] == "application/json"
+		}
+		return mediaTypes[i] < mediaTypes[j]
+	})
+	return mediaTypes
+}
@@ -0,0 +1,147 @@
+package gtw
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type (
+	// ProblemDetails is an RFC 7807 problem. Extensions are serialized as
+	// top level members next to the standard ones.
+	ProblemDetails struct {
+		Type       string
+		Title      string
+		Status     int
+		Detail     string
+		Instance   string
+		Extensions map[string]any
+	}
+)
+
+func NewProblem(status int, detail string) *ProblemDetails {
+	return &ProblemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+func (problem *ProblemDetails) With(key string, value any) *ProblemDetails {
+	if problem.Extensions == nil {
+		problem.Extensions = make(map[string]any)
+	}
+	problem.Extensions[key] = value
+	return problem
+}
+
+// clone copies problem so that defaults can be filled in without changing a
+// problem that is declared once and returned by many requests.
+func (problem *ProblemDetails) clone() *ProblemDetails {
+	output := *problem
+	if problem.Extensions != nil {
+		output.Extensions = make(map[string]any, len(problem.Extensions))
+		for key, value := range problem.Extensions {
+			output.Extensions[key] = value
+		}
+	}
+	return &output
+}
+
+func (problem *ProblemDetails) Error() string {
+	if len(problem.Detail) == 0 {
+		return fmt.Sprintf("%d %s", problem.Status, problem.Title)
+	}
+	return fmt.Sprintf("%d %s: %s", problem.Status, problem.Title, problem.Detail)
+}
+
+func (problem *ProblemDetails) MarshalJSON() ([]byte, error) {
+	output := make(map[string]any, len(problem.Extensions)+5)
+	for key, value := range problem.Extensions {
+		output[key] = value
+	}
+	output["type"] = problem.Type
+	output["title"] = problem.Title
+	output["status"] = problem.Status
+	if len(problem.Detail) != 0 {
+		output["detail"] = problem.Detail
+	}
+	if len(problem.Instance) != 0 {
+		output["instance"] = problem.Instance
+	}
+	return json.Marshal(output)
+}
+
+// Problem writes problem as `application/problem+json`. The handler status is
+// used when the problem does not declare one of its own.
+func Problem(problem *ProblemDetails) func(status int, w http.ResponseWriter) {
+	return func(status int, w http.ResponseWriter) {
+		problem := problem.clone()
+		if problem.Status == 0 {
+			problem.Status = status
+			problem.Title = http.StatusText(status)
+		}
+		if len(problem.Type) == 0 {
+			problem.Type = "about:blank"
+		}
+		if writer, ok := unwrap(w); ok && len(problem.Instance) == 0 {
+			problem.Instance = writer.request.URL.Path
+		}
+		json, _err := json.Marshal(problem)
+		if _err != nil {
+			http.Error(w, _err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(problem.Status)
+		w.Write(json)
+	}
+}
+
+// Problems makes the server render every error it generates itself, such as
+// unknown routes, disallowed methods, oversized bodies, validation failures,
+// recovered panics and errors returned by handlers, as problem details.
+func (srv *Server) Problems(enabled bool) *Server {
+	srv.problems = enabled
+	return srv
+}
+
+// fail writes a framework generated error response.
+func (srv *Server) fail(w http.ResponseWriter, r *http.Request, problem *ProblemDetails) {
+	if srv.problems {
+		problem := problem.clone()
+		if len(problem.Instance) == 0 {
+			problem.Instance = r.URL.Path
+		}
+		Problem(problem)(problem.Status, w)
+		return
+	}
+	if problem.Status == http.StatusNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if len(problem.Detail) != 0 {
+		http.Error(w, problem.Detail, problem.Status)
+		return
+	}
+	http.Error(w, http.StatusText(problem.Status), problem.Status)
+}
+
+// failure is a Response that reports problem the same way as errors generated
+// by the framework itself.
+func failure(problem *ProblemDetails) Response {
+	return func(_ int, w http.ResponseWriter) {
+		writeError(w, problem)
+	}
+}
+
+// writeError reports an error raised while writing a response through the
+// server that owns w, if any.
+func writeError(w http.ResponseWriter, problem *ProblemDetails) {
+	if writer, ok := unwrap(w); ok {
+		writer.server.fail(w, writer.request, problem)
+		return
+	}
+	http.Error(w, problem.Detail, problem.Status)
+}
@@ -0,0 +1,148 @@
+package gtw
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/vedadiyan/gtw/internal/structutil"
+)
+
+type (
+	Query url.Values
+)
+
+// Query returns the query string of the request.
+func (httpCtx *HttpCtx) Query() Query {
+	return Query((*http.Request)(httpCtx.Request.Reader).URL.Query())
+}
+
+// Unmarshal binds the query string into v, a pointer to a struct, and
+// validates the result against its `validate` tags. Each field is read from
+// the key named by its `query` tag, falling back to its `json` name or field
+// name; `query:"-"` skips the field.
+//
+// Slices collect repeated keys and comma separated lists (`?tag=a,b&tag=c`),
+// maps and structs collect bracketed keys (`?filter[name]=x`) and the
+// `default` tag supplies the raw value of a missing key.
+func (query Query) Unmarshal(v any) error {
+	if err := query.bind(v, "query"); err != nil {
+		return err
+	}
+	return Validate(v)
+}
+
+// bind sets the fields of v from the keys named by their tag, skipping fields
+// tagged `file`.
+func (query Query) bind(v any, tag string) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected a pointer to a struct but found %T", v)
+	}
+	value = value.Elem()
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := field.Tag.Lookup(tag)
+		if _, file := field.Tag.Lookup("file"); !field.IsExported() || name == "-" || file {
+			continue
+		}
+		if !ok {
+			name = jsonName(field)
+		}
+		raw, ok, err := query.value(field, name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		output, err := convert(field.Type, raw)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s parameter `%s`: %w", tag, name, err)
+		}
+		value.Field(i).Set(output)
+	}
+	return nil
+}
+
+// value collects the raw value of name in the shape structutil expects for
+// the type of field: a string, a []any of strings or a map[string]any.
+func (query Query) value(field reflect.StructField, name string) (any, bool, error) {
+	t := field.Type
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		values := splitValues(append(query[name], query[name+"[]"]...))
+		if len(values) == 0 {
+			fallback, ok := field.Tag.Lookup("default")
+			if !ok {
+				return nil, false, nil
+			}
+			values = splitValues([]string{fallback})
+		}
+		output := make([]any, len(values))
+		for i, value := range values {
+			output[i] = value
+		}
+		return output, true, nil
+	case reflect.Map, reflect.Struct:
+		output := make(map[string]any)
+		for key, values := range query {
+			if !strings.HasPrefix(key, name+"[") || !strings.HasSuffix(key, "]") || len(values) == 0 {
+				continue
+			}
+			key = key[len(name)+1 : len(key)-1]
+			if t.Kind() == reflect.Struct {
+				output[key] = values[0]
+				continue
+			}
+			if t.Key().Kind() != reflect.String {
+				return nil, false, fmt.Errorf("parameter `%s` must bind to a map with string keys", name)
+			}
+			var raw any = values[0]
+			if t.Elem().Kind() == reflect.Slice {
+				raw, _, _ = Query{key: values}.value(reflect.StructField{Type: t.Elem()}, key)
+			}
+			element, err := convert(t.Elem(), raw)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid value for parameter `%s[%s]`: %w", name, key, err)
+			}
+			output[key] = element.Interface()
+		}
+		return output, len(output) != 0, nil
+	}
+	if values, ok := query[name]; ok && len(values) != 0 {
+		return values[0], true, nil
+	}
+	if fallback, ok := field.Tag.Lookup("default"); ok {
+		return fallback, true, nil
+	}
+	return nil, false, nil
+}
+
+// convert runs raw through structutil by binding it to a single field struct
+// of type t, so query values follow the same conversion rules as route values.
+func convert(t reflect.Type, raw any) (reflect.Value, error) {
+	holder := reflect.New(reflect.StructOf([]reflect.StructField{{Name: "Value", Type: t}}))
+	if err := structutil.Unmarshal(map[string]any{"Value": raw}, holder.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return holder.Elem().Field(0), nil
+}
+
+func splitValues(values []string) []string {
+	output := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) != 0 {
+				output = append(output, item)
+			}
+		}
+	}
+	return output
+}
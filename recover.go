@@ -0,0 +1,67 @@
+package gtw
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+type (
+	PanicReport struct {
+		Value   any
+		Stack   []byte
+		Method  string
+		Pattern string
+		Source  string
+		Request *http.Request
+	}
+	PanicHandler func(report *PanicReport) (Status, Response)
+)
+
+// Recover replaces the response written when a handler panics. The default
+// responds 500 with a JSON body, or a problem when Problems is enabled, that
+// does not leak the panic value.
+func (srv *Server) Recover(panicHandler PanicHandler) *Server {
+	srv.panicHandler = panicHandler
+	return srv
+}
+
+// OnPanic registers a hook invoked with every recovered panic, for example to
+// forward it to an error tracker. Hooks run after the panic has been logged.
+func (srv *Server) OnPanic(hook func(report *PanicReport)) *Server {
+	srv.panicHooks = append(srv.panicHooks, hook)
+	return srv
+}
+
+func (srv *Server) defaultPanicHandler(report *PanicReport) (Status, Response) {
+	if srv.problems {
+		return http.StatusInternalServerError, Problem(NewProblem(http.StatusInternalServerError, ""))
+	}
+	return http.StatusInternalServerError, JSON(map[string]any{
+		"status":  http.StatusInternalServerError,
+		"message": http.StatusText(http.StatusInternalServerError),
+	})
+}
+
+func (srv *Server) recover(w http.ResponseWriter, r *http.Request, endpoint *endpoint, value any) {
+	if value == http.ErrAbortHandler {
+		panic(value)
+	}
+	report := &PanicReport{
+		Value:   value,
+		Stack:   debug.Stack(),
+		Method:  endpoint.method,
+		Pattern: endpoint.pattern,
+		Source:  endpoint.source,
+		Request: r,
+	}
+	log.Printf("gtw: panic serving %s %s%s: %v\n%s", report.Method, report.Pattern, registeredBy(endpoint), value, report.Stack)
+	for _, hook := range srv.panicHooks {
+		hook(report)
+	}
+	if w, ok := w.(*responseWriter); ok && w.started() {
+		return
+	}
+	status, response := srv.panicHandler(report)
+	response(status, w)
+}
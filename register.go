@@ -0,0 +1,277 @@
+package gtw
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+type (
+	group struct {
+		prefix     string
+		middleware []Middleware
+		timeout    time.Duration
+	}
+)
+
+var (
+	_handlerType  = reflect.TypeOf(func(*HttpCtx) (Status, Response) { return 0, nil })
+	_metadataType = reflect.TypeOf(Metadata(0))
+)
+
+func (srv *Server) Register(v any) error {
+	t := reflect.TypeOf(v)
+	if t.Kind() != reflect.Pointer {
+		return fmt.Errorf("expected pointer buy found value")
+	}
+	if t.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected struct but found %T", v)
+	}
+	prefix, _ := prefixOf(t.Elem())
+	return errors.Join(srv.register(reflect.ValueOf(v), &group{}, prefix, map[reflect.Type]bool{t.Elem(): true})...)
+}
+
+// Strict controls whether Server.Register reports Handler fields whose
+// handler method is missing or has an unsupported signature. It is on by
+// default; when turned off such fields are skipped silently.
+func (srv *Server) Strict(strict bool) *Server {
+	srv.strict = strict
+	return srv
+}
+
+// register walks the fields of the API struct val points to. Fields holding
+// other API structs are registered recursively as route groups nested under
+// the prefix of their parent and inheriting its middleware.
+func (srv *Server) register(val reflect.Value, parent *group, prefix string, visited map[reflect.Type]bool) []error {
+	t := val.Type()
+	group, err := srv.group(val, parent, prefix)
+	if err != nil {
+		return []error{err}
+	}
+	errs := make([]error, 0)
+	lenOfFields := t.Elem().NumField()
+	for i := 0; i < lenOfFields; i++ {
+		field := t.Elem().Field(i)
+		if isMetadata(field) {
+			continue
+		}
+		if _, ok := field.Tag.Lookup("static"); ok {
+			if err := srv.registerStatic(val, field, group); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if field.Type.AssignableTo(_handlerType) {
+			if err := srv.registerHandler(val, field, group); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if isService(field.Type) {
+			rf := val.Elem().Field(i)
+			name, ok := field.Tag.Lookup("name")
+			if ok {
+				f := rf.FieldByName("name")
+				f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+				f.Set(reflect.ValueOf(name))
+			}
+			continue
+		}
+		if nested := elemOf(field.Type); isAPI(nested, visited) {
+			rf := val.Elem().Field(i)
+			rf = reflect.NewAt(rf.Type(), unsafe.Pointer(rf.UnsafeAddr())).Elem()
+			if rf.Kind() == reflect.Pointer {
+				if rf.IsNil() {
+					rf.Set(reflect.New(nested))
+				}
+			} else {
+				rf = rf.Addr()
+			}
+			prefix, ok := prefixOf(nested)
+			if field.Anonymous && !ok {
+				prefix = ""
+			}
+			visited[nested] = true
+			errs = append(errs, srv.register(rf, group, prefix, visited)...)
+			delete(visited, nested)
+		}
+	}
+	return errs
+}
+
+func (srv *Server) registerHandler(val reflect.Value, field reflect.StructField, group *group) error {
+	t := val.Type()
+	route, ok := field.Tag.Lookup("route")
+	if !ok {
+		route = field.Name
+	}
+	httpMethod, ok := field.Tag.Lookup("method")
+	if !ok {
+		httpMethod = http.MethodGet
+	}
+	source := fmt.Sprintf("%s.%s", t.Elem().String(), field.Name)
+	methodName, ok := field.Tag.Lookup("handler")
+	if !ok {
+		methodName = fmt.Sprintf("%sHandler", field.Name)
+	}
+	method, err := srv.toHandler(val.MethodByName(methodName))
+	if err != nil {
+		if srv.strict {
+			return fmt.Errorf("%s: method `%s` %w", source, methodName, err)
+		}
+		return nil
+	}
+	middleware, err := srv.resolveMiddleware(field.Tag.Get("middleware"))
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	timeout, err := timeoutOf(field, group.timeout)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	limits, err := limitsOf(field)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	return srv.handle(join(group.prefix, route), &endpoint{
+		method:       httpMethod,
+		source:       source,
+		handler:      chain(chain(method, middleware), group.middleware),
+		autoHead:     field.Tag.Get("head") != "off",
+		timeout:      timeout,
+		limits:       limits,
+		uncompressed: field.Tag.Get("compress") == "off",
+	})
+}
+
+func (srv *Server) group(val reflect.Value, parent *group, prefix string) (*group, error) {
+	t := val.Type()
+	middleware := append(make([]Middleware, 0), parent.middleware...)
+	timeout := parent.timeout
+	for i := 0; i < t.Elem().NumField(); i++ {
+		field := t.Elem().Field(i)
+		if !isMetadata(field) {
+			continue
+		}
+		tagged, err := srv.resolveMiddleware(field.Tag.Get("middleware"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Elem().String(), err)
+		}
+		middleware = append(middleware, tagged...)
+		timeout, err = timeoutOf(field, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Elem().String(), err)
+		}
+	}
+	if t.Implements(_middlewareProviderType) {
+		middleware = append(middleware, val.Interface().(interface{ Middleware() []Middleware }).Middleware()...)
+	}
+	return &group{
+		prefix:     join(parent.prefix, prefix),
+		middleware: middleware,
+		timeout:    timeout,
+	}, nil
+}
+
+func timeoutOf(field reflect.StructField, fallback time.Duration) (time.Duration, error) {
+	tag, ok := field.Tag.Lookup("timeout")
+	if !ok {
+		return fallback, nil
+	}
+	timeout, err := time.ParseDuration(tag)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout `%s`: %w", tag, err)
+	}
+	return timeout, nil
+}
+
+// toHandler adapts the supported handler method shapes to a Handler. Errors
+// returned by a method are translated through the server's ErrorMapper.
+func (srv *Server) toHandler(method reflect.Value) (Handler, error) {
+	if !method.IsValid() {
+		return nil, fmt.Errorf("not found")
+	}
+	switch handler := method.Interface().(type) {
+	case func(*HttpCtx) (Status, Response):
+		return handler, nil
+	case func(*HttpCtx) (Response, error):
+		return func(httpCtx *HttpCtx) (Status, Response) {
+			response, err := handler(httpCtx)
+			if err != nil {
+				return srv.errorMapper(httpCtx, err)
+			}
+			return http.StatusOK, response
+		}, nil
+	case func(*HttpCtx) error:
+		return func(httpCtx *HttpCtx) (Status, Response) {
+			if err := handler(httpCtx); err != nil {
+				return srv.errorMapper(httpCtx, err)
+			}
+			return http.StatusNoContent, Empty()
+		}, nil
+	}
+	if handler, ok := srv.typedHandler(method); ok {
+		return handler, nil
+	}
+	return nil, fmt.Errorf("has unsupported signature `%s`, expected one of `func(*gtw.HttpCtx) (gtw.Status, gtw.Response)`, `func(*gtw.HttpCtx) (gtw.Response, error)`, `func(*gtw.HttpCtx) error`, `func(*gtw.HttpCtx, *In) (gtw.Status, Out)` or `func(*gtw.HttpCtx, *In) (Out, error)`", method.Type())
+}
+
+// prefixOf returns the prefix declared by the Metadata field of t, falling back
+// to the name of the type when t has no Metadata field.
+func prefixOf(t reflect.Type) (string, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isMetadata(field) {
+			return field.Tag.Get("prefix"), true
+		}
+	}
+	return t.Name(), false
+}
+
+func isMetadata(field reflect.StructField) bool {
+	return field.Name == "Metadata" && field.Type.AssignableTo(_metadataType)
+}
+
+func isService(t reflect.Type) bool {
+	return strings.HasPrefix(t.Name(), "Service[") && t.PkgPath() == "github.com/vedadiyan/gtw"
+}
+
+func elemOf(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+// isAPI reports whether t is a struct declaring a Metadata field, a Handler
+// field or another API struct. Types already being registered are ignored to
+// avoid following recursive types forever.
+func isAPI(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if t.Kind() != reflect.Struct || isService(t) || visited[t] {
+		return false
+	}
+	visited[t] = true
+	defer delete(visited, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isMetadata(field) || field.Type.AssignableTo(_handlerType) || isAPI(elemOf(field.Type), visited) {
+			return true
+		}
+	}
+	return false
+}
+
+func join(segments ...string) string {
+	path := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		segment = strings.Trim(segment, "/")
+		if len(segment) != 0 {
+			path = append(path, segment)
+		}
+	}
+	return "/" + strings.Join(path, "/")
+}
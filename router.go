@@ -2,13 +2,16 @@ package gtw
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/gorilla/websocket"
 	"github.com/vedadiyan/gtw/internal/structutil"
@@ -26,14 +29,21 @@ type (
 			*Reader
 			RouteValues RouteValues
 		}
+		server  *Server
+		sockets []*websocket.Conn
+		streams []*EventStream
+		values  map[string]any
+		mut     sync.Mutex
 	}
 	HttpError struct {
 		Status  int
 		Message any
 	}
 	RouteTable struct {
-		routes  map[int][]*Route
-		configs map[string]Handler
+		root      *node
+		configs   map[string]Handler
+		shapes    map[string]*endpoint
+		maxParams int
 	}
 	Route struct {
 		path        string
@@ -47,8 +57,9 @@ type (
 )
 
 const (
-	NO_MATCH_FOUND    RouterError = "no match found"
-	NO_URL_REGISTERED RouterError = "no url registered"
+	NO_MATCH_FOUND     RouterError = "no match found"
+	NO_URL_REGISTERED  RouterError = "no url registered"
+	METHOD_NOT_ALLOWED RouterError = "method not allowed"
 )
 
 var (
@@ -63,8 +74,9 @@ func init() {
 
 func NewRouteTable() *RouteTable {
 	routeTable := RouteTable{
-		routes:  map[int][]*Route{},
+		root:    newNode(),
 		configs: make(map[string]Handler),
+		shapes:  make(map[string]*endpoint),
 	}
 	return &routeTable
 }
@@ -149,81 +161,219 @@ func CreateHash(url *url.URL, method string) string {
 	return hash
 }
 
-func (rt *RouteTable) Register(url *url.URL, method string, handlerFunc Handler) {
-	route := ParseRoute(url, method)
-	len := len(route.routeValues)
-	if _, ok := rt.configs[route.hash]; ok {
-		return
+func (rt *RouteTable) Register(url *url.URL, method string, handlerFunc Handler) error {
+	return rt.register(url, &endpoint{
+		method:   method,
+		handler:  handlerFunc,
+		autoHead: true,
+	})
+}
+
+func (rt *RouteTable) register(url *url.URL, endpoint *endpoint) error {
+	tokens, err := tokenize(url.Path)
+	if err != nil {
+		return err
 	}
-	rt.configs[route.hash] = handlerFunc
-	_, ok := rt.routes[len]
-	if !ok {
-		rt.routes[len] = make([]*Route, 0)
+	endpoint.pattern = cleanPath(url.Path)
+	endpoint.method = strings.ToUpper(endpoint.method)
+	key := fmt.Sprintf("%s %s", endpoint.method, shape(tokens))
+	if existing, ok := rt.shapes[key]; ok {
+		return routeConflictError(existing, endpoint)
 	}
-	rt.routes[len] = append(rt.routes[len], route)
+	rt.shapes[key] = endpoint
+	rt.root.insert(tokens).addEndpoint(endpoint)
+	// configs is not used for routing; it is only kept up to date so that
+	// the exported GetHandlerFunc keeps working for existing callers.
+	rt.configs[CreateHash(url, endpoint.method)] = endpoint.handler
+	params := 0
+	for _, token := range tokens {
+		if token.kind == paramNode || token.kind == catchAllNode {
+			params++
+		}
+	}
+	if params > rt.maxParams {
+		rt.maxParams = params
+	}
+	return nil
 }
 
 func (rt RouteTable) Find(url *url.URL, method string) (http.HandlerFunc, error) {
-	if len(rt.routes) == 0 {
-		return nil, NO_URL_REGISTERED
+	endpoint, params, err := rt.find(url, method)
+	if err != nil {
+		return nil, err
 	}
-	prt := ParseRoute(url, method)
-	routes, ok := rt.routes[len(prt.routeValues)]
-	if !ok {
-		return nil, NO_MATCH_FOUND
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoint.serveHTTP(w, r, params, endpoint.handler, nil)
+	}, nil
+}
+
+func (rt RouteTable) find(url *url.URL, method string) (*endpoint, []param, error) {
+	if len(rt.root.children) == 0 {
+		return nil, nil, NO_URL_REGISTERED
 	}
-	lrnk := 0
-	var lrt *Route
-	for _, url := range routes {
-		if method != "*" && url.method != strings.ToUpper(method) {
-			continue
+	if method != "*" {
+		method = strings.ToUpper(method)
+	}
+	params := make([]param, 0, rt.maxParams)
+	endpoint := rt.root.lookup(cleanPath(url.Path), method, &params)
+	if endpoint == nil {
+		if method != "*" && len(rt.Allowed(url)) != 0 {
+			return nil, nil, METHOD_NOT_ALLOWED
 		}
-		rnk := RouteCompare(url, prt)
-		if rnk != 0 {
-			if rnk > lrnk {
-				lrnk = rnk
-				lrt = url
+		return nil, nil, NO_MATCH_FOUND
+	}
+	return endpoint, params, nil
+}
+
+func (endpoint *endpoint) serveHTTP(w http.ResponseWriter, r *http.Request, params []param, handler Handler, server *Server) {
+	routeValues := make(RouteValues, len(params))
+	for _, param := range params {
+		routeValues[param.key] = param.value
+	}
+	if endpoint.timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), endpoint.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	r = withScope(r, server, endpoint)
+	httpCtx := &HttpCtx{
+		Response: w,
+		Request: struct {
+			*Reader
+			RouteValues RouteValues
+		}{
+			Reader:      (*Reader)(r),
+			RouteValues: routeValues,
+		},
+		server: server,
+	}
+	if server != nil {
+		defer func() {
+			if value := recover(); value != nil {
+				server.recover(w, r, endpoint, value)
 			}
+		}()
+	}
+	defer httpCtx.untrack()
+	defer func() {
+		if r.MultipartForm != nil {
+			r.MultipartForm.RemoveAll()
 		}
+	}()
+	var head *headWriter
+	if endpoint.method != r.Method && r.Method == http.MethodHead {
+		head = &headWriter{ResponseWriter: w}
+		httpCtx.Response = head
 	}
-	if lrnk == 0 {
-		return nil, NO_MATCH_FOUND
+	status, value := handler(httpCtx)
+	value(status, httpCtx.Response)
+	if head != nil {
+		head.flush()
 	}
-	return func(w http.ResponseWriter, r *http.Request) {
-		httpCtx := &HttpCtx{
-			Response: w,
-			Request: struct {
-				*Reader
-				RouteValues RouteValues
-			}{
-				Reader:      (*Reader)(r),
-				RouteValues: lrt.Bind(prt),
-			},
+}
+
+func (rt RouteTable) Allowed(url *url.URL) []string {
+	methods := make([]string, 0)
+	rt.root.walk(cleanPath(url.Path), func(n *node) {
+		for _, endpoint := range n.endpoints {
+			methods = append(methods, endpoint.method)
+			if endpoint.method == http.MethodGet && endpoint.autoHead {
+				methods = append(methods, http.MethodHead)
+			}
 		}
-		status, value := rt.GetHandlerFunc(lrt.hash)(httpCtx)
-		value(status, w)
+	})
+	sort.Strings(methods)
+	unique := methods[:0]
+	for index, method := range methods {
+		if index == 0 || method != methods[index-1] {
+			unique = append(unique, method)
+		}
+	}
+	return unique
+}
 
-	}, nil
+func routeConflictError(existing *endpoint, endpoint *endpoint) error {
+	reason := "is ambiguous with"
+	if existing.pattern == endpoint.pattern {
+		reason = "duplicates"
+	}
+	return fmt.Errorf("route `%s %s`%s %s route `%s %s`%s", endpoint.method, endpoint.pattern, registeredBy(endpoint), reason, existing.method, existing.pattern, registeredBy(existing))
+}
+
+func registeredBy(endpoint *endpoint) string {
+	if len(endpoint.source) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", endpoint.source)
 }
 
 func (rt RouteTable) GetHandlerFunc(hash string) Handler {
 	return rt.configs[hash]
 }
 
+// Unmarshal binds the route values into v and validates the result against
+// its `validate` tags.
 func (rv RouteValues) Unmarshal(v any) error {
-	return structutil.Unmarshal(rv, v)
+	if err := structutil.Unmarshal(rv, v); err != nil {
+		return err
+	}
+	return Validate(v)
 }
 
+// Unmarshal decodes the request body into v and validates the result against
+// its `validate` tags.
 func (r *Reader) Unmarshal(v any) error {
+	if err := r.decode(v); err != nil {
+		return err
+	}
+	return Validate(v)
+}
+
+// decode reads the body with the codec registered for its Content-Type,
+// defaulting to JSON when the header is missing.
+func (r *Reader) decode(v any) error {
+	mediaType := mediaTypeOf(r.Header)
+	switch mediaType {
+	case "":
+		mediaType = "application/json"
+	case "application/x-www-form-urlencoded":
+		return r.decodeForm(v)
+	case "multipart/form-data":
+		return r.decodeMultipart(v)
+	}
+	codec, ok := scopeOf((*http.Request)(r)).codecs().lookup(mediaType)
+	if !ok {
+		return NewProblem(http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported media type `%s`", mediaType))
+	}
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(data, v)
+	return codec.Unmarshal(data, v)
 }
 
+// Upgrade switches the connection to the WebSocket protocol. The connection
+// is tracked by the server until the handler returns so that Server.Shutdown
+// can close it.
 func (httpCtx *HttpCtx) Upgrade(headers http.Header) (*websocket.Conn, error) {
-	return _upgrader.Upgrade(httpCtx.Response, (*http.Request)(httpCtx.Request.Reader), headers)
+	conn, err := _upgrader.Upgrade(httpCtx.Response, (*http.Request)(httpCtx.Request.Reader), headers)
+	if err != nil {
+		return nil, err
+	}
+	if httpCtx.server != nil {
+		httpCtx.server.track(conn)
+		httpCtx.sockets = append(httpCtx.sockets, conn)
+	}
+	return conn, nil
+}
+
+func (httpCtx *HttpCtx) untrack() {
+	for _, conn := range httpCtx.sockets {
+		httpCtx.server.untrack(conn)
+	}
+	for _, stream := range httpCtx.streams {
+		stream.Close()
+	}
 }
 
 func WithHeader(r func(status int, w http.ResponseWriter), h http.Header) func(status int, w http.ResponseWriter) {
@@ -233,6 +383,29 @@ func WithHeader(r func(status int, w http.ResponseWriter), h http.Header) func(s
 	}
 }
 
+// SetCookie adds cookies to the response written by r.
+func SetCookie(r func(status int, w http.ResponseWriter), cookies ...*http.Cookie) func(status int, w http.ResponseWriter) {
+	return func(status int, w http.ResponseWriter) {
+		for _, cookie := range cookies {
+			http.SetCookie(w, cookie)
+		}
+		r(status, w)
+	}
+}
+
+// Redirect replies with a redirect to location using code, which takes
+// precedence over the handler status. Relative locations are resolved against
+// the request path.
+func Redirect(location string, code int) func(status int, w http.ResponseWriter) {
+	return func(_ int, w http.ResponseWriter) {
+		r := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/"}}
+		if writer, ok := unwrap(w); ok {
+			r = writer.request
+		}
+		http.Redirect(w, r, location, code)
+	}
+}
+
 func Header(headers http.Header) func(_ int, w http.ResponseWriter) {
 	return func(_ int, w http.ResponseWriter) {
 		for key := range headers {
@@ -242,16 +415,7 @@ func Header(headers http.Header) func(_ int, w http.ResponseWriter) {
 }
 
 func JSON(v any) func(status int, w http.ResponseWriter) {
-	return func(status int, w http.ResponseWriter) {
-		json, _err := json.Marshal(v)
-		if _err != nil {
-			http.Error(w, _err.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(status)
-		w.Write(json)
-	}
+	return Encode("application/json", v)
 }
 
 func Raw(data []byte) func(status int, w http.ResponseWriter) {
@@ -266,3 +430,9 @@ func Empty() func(status int, w http.ResponseWriter) {
 		w.WriteHeader(status)
 	}
 }
+
+// NoResponse writes nothing. It is returned by handlers that already wrote
+// the response themselves, e.g. through HttpCtx.EventStream.
+func NoResponse() func(status int, w http.ResponseWriter) {
+	return func(status int, w http.ResponseWriter) {}
+}
@@ -0,0 +1,281 @@
+package gtw
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type (
+	linearRouteTable struct {
+		routes  map[int][]*Route
+		configs map[string]Handler
+	}
+)
+
+// linearRouteTable is the segment-count bucketed table the radix tree
+// replaced. It is kept here only as a baseline for the benchmarks.
+func newLinearRouteTable() *linearRouteTable {
+	return &linearRouteTable{
+		routes:  map[int][]*Route{},
+		configs: map[string]Handler{},
+	}
+}
+
+func (rt *linearRouteTable) Register(url *url.URL, method string, handlerFunc Handler) error {
+	route := ParseRoute(url, method)
+	if _, ok := rt.configs[route.hash]; ok {
+		return nil
+	}
+	rt.configs[route.hash] = handlerFunc
+	rt.routes[len(route.routeValues)] = append(rt.routes[len(route.routeValues)], route)
+	return nil
+}
+
+func (rt *linearRouteTable) Find(url *url.URL, method string) (Handler, error) {
+	prt := ParseRoute(url, method)
+	lrnk := 0
+	var lrt *Route
+	for _, route := range rt.routes[len(prt.routeValues)] {
+		if route.method != strings.ToUpper(method) {
+			continue
+		}
+		if rnk := RouteCompare(route, prt); rnk > lrnk {
+			lrnk = rnk
+			lrt = route
+		}
+	}
+	if lrnk == 0 {
+		return nil, NO_MATCH_FOUND
+	}
+	lrt.Bind(prt)
+	return rt.configs[lrt.hash], nil
+}
+
+func handlerOf(name string) Handler {
+	return func(httpCtx *HttpCtx) (Status, Response) {
+		return 200, JSON(map[string]any{
+			"handler":     name,
+			"routeValues": httpCtx.Request.RouteValues,
+		})
+	}
+}
+
+func mustParse(t testing.TB, route string) *url.URL {
+	url, err := url.Parse(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return url
+}
+
+func serve(t testing.TB, rt *RouteTable, method string, route string) (string, RouteValues, error) {
+	handlerFunc, err := rt.Find(mustParse(t, route), method)
+	if err != nil {
+		return "", nil, err
+	}
+	recorder := httptest.NewRecorder()
+	handlerFunc(recorder, httptest.NewRequest(method, route, nil))
+	body := struct {
+		Handler     string      `json:"handler"`
+		RouteValues RouteValues `json:"routeValues"`
+	}{}
+	if err := (*Reader)(&http.Request{Body: recorder.Result().Body}).Unmarshal(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Handler, body.RouteValues, nil
+}
+
+func TestRouteTableFind(t *testing.T) {
+	rt := NewRouteTable()
+	routes := []struct {
+		method string
+		route  string
+	}{
+		{"GET", "/"},
+		{"GET", "/api/users"},
+		{"GET", "/api/users/:id"},
+		{"GET", "/api/users/me"},
+		{"POST", "/api/users/admin"},
+		{"GET", "/api/users/:id/posts/:post"},
+		{"GET", "/api/uploads/:name"},
+		{"GET", "/files/*path"},
+		{"GET", "/files/public/*"},
+		{"GET", "/files/public/*/meta"},
+		{"GET", "/files/private/:name"},
+	}
+	for _, route := range routes {
+		if err := rt.Register(mustParse(t, route.route), route.method, handlerOf(route.method+" "+route.route)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		method      string
+		route       string
+		handler     string
+		routeValues RouteValues
+		err         error
+	}{
+		{"GET", "/", "GET /", RouteValues{}, nil},
+		{"GET", "/api/users/", "GET /api/users", RouteValues{}, nil},
+		{"GET", "/api//users/", "GET /api/users", RouteValues{}, nil},
+		{"GET", "/api/users/me", "GET /api/users/me", RouteValues{}, nil},
+		{"GET", "/api/users/42", "GET /api/users/:id", RouteValues{"id": "42"}, nil},
+		{"GET", "/api/users/admin", "GET /api/users/:id", RouteValues{"id": "admin"}, nil},
+		{"get", "/api/users/42/posts/7", "GET /api/users/:id/posts/:post", RouteValues{"id": "42", "post": "7"}, nil},
+		{"GET", "/api/uploads/a", "GET /api/uploads/:name", RouteValues{"name": "a"}, nil},
+		{"GET", "/api/use", "", nil, NO_MATCH_FOUND},
+		{"GET", "/api/users/42/posts", "", nil, NO_MATCH_FOUND},
+		{"DELETE", "/api/users", "", nil, METHOD_NOT_ALLOWED},
+		{"GET", "/files/css/site.css", "GET /files/*path", RouteValues{"path": "css/site.css"}, nil},
+		{"GET", "/files/public/logo.png", "GET /files/public/*", RouteValues{}, nil},
+		{"GET", "/files/public/logo.png/meta", "GET /files/public/*/meta", RouteValues{}, nil},
+		{"GET", "/files/public/a/b", "GET /files/*path", RouteValues{"path": "public/a/b"}, nil},
+		{"GET", "/files/private/a", "GET /files/private/:name", RouteValues{"name": "a"}, nil},
+		{"GET", "/files/private/a/b", "GET /files/*path", RouteValues{"path": "private/a/b"}, nil},
+		{"GET", "/files", "", nil, NO_MATCH_FOUND},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.route, func(t *testing.T) {
+			handler, routeValues, err := serve(t, rt, test.method, test.route)
+			if err != test.err {
+				t.Fatalf("expected error %v but found %v", test.err, err)
+			}
+			if handler != test.handler {
+				t.Fatalf("expected handler %q but found %q", test.handler, handler)
+			}
+			if fmt.Sprint(routeValues) != fmt.Sprint(test.routeValues) {
+				t.Fatalf("expected route values %v but found %v", test.routeValues, routeValues)
+			}
+		})
+	}
+}
+
+func TestRouteTableRegisterCatchAll(t *testing.T) {
+	err := NewRouteTable().Register(mustParse(t, "/files/*path/meta"), "GET", handlerOf(""))
+	if err == nil {
+		t.Fatal("expected catch-all segment in the middle of a route to be rejected")
+	}
+}
+
+func TestRouteTableConstraints(t *testing.T) {
+	rt := NewRouteTable()
+	var handler string
+	var routeValues RouteValues
+	for _, route := range []string{"/users/:id", "/users/:id<int>", "/files/:name<[a-z0-9-]+>", "/t/:ts<uuid>"} {
+		route := route
+		err := rt.Register(mustParse(t, route), "GET", func(httpCtx *HttpCtx) (Status, Response) {
+			handler = route
+			routeValues = httpCtx.Request.RouteValues
+			return 200, Empty()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		route   string
+		handler string
+		value   any
+	}{
+		{"/users/42", "/users/:id<int>", 42},
+		{"/users/me", "/users/:id", "me"},
+		{"/files/site-1", "/files/:name<[a-z0-9-]+>", "site-1"},
+		{"/files/Site", "", nil},
+		{"/t/123e4567-e89b-12d3-a456-426614174000", "/t/:ts<uuid>", "123e4567-e89b-12d3-a456-426614174000"},
+		{"/t/123", "", nil},
+	}
+	for _, test := range tests {
+		handler, routeValues = "", nil
+		handlerFunc, err := rt.Find(mustParse(t, test.route), "GET")
+		if test.handler == "" {
+			if err != NO_MATCH_FOUND {
+				t.Fatalf("%s: expected %v but found %v", test.route, NO_MATCH_FOUND, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.route, err)
+		}
+		handlerFunc(httptest.NewRecorder(), httptest.NewRequest("GET", test.route, nil))
+		if handler != test.handler {
+			t.Fatalf("%s: expected handler %q but found %q", test.route, test.handler, handler)
+		}
+		for _, value := range routeValues {
+			if value != test.value {
+				t.Fatalf("%s: expected %#v but found %#v", test.route, test.value, value)
+			}
+		}
+	}
+	if err := rt.Register(mustParse(t, "/bad/:id<[a-z>"), "GET", handlerOf("")); err == nil {
+		t.Fatal("expected invalid constraint to be rejected")
+	}
+}
+
+func TestRouteTableConflicts(t *testing.T) {
+	rt := NewRouteTable()
+	for _, route := range []string{"/a/:x", "/a/:x<int>", "/files/*path"} {
+		if err := rt.Register(mustParse(t, route), "GET", handlerOf("")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rt.Register(mustParse(t, "/a/:x"), "POST", handlerOf("")); err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range []string{"/a/:x/", "/a/:y", "/a/:id<int>", "/files/*rest"} {
+		if err := rt.Register(mustParse(t, route), "GET", handlerOf("")); err == nil {
+			t.Fatalf("expected %s to conflict", route)
+		}
+	}
+}
+
+func TestRouteTableFindEmpty(t *testing.T) {
+	_, err := NewRouteTable().Find(mustParse(t, "/"), "GET")
+	if err != NO_URL_REGISTERED {
+		t.Fatalf("expected %v but found %v", NO_URL_REGISTERED, err)
+	}
+}
+
+type (
+	registrar interface {
+		Register(url *url.URL, method string, handlerFunc Handler) error
+	}
+)
+
+func benchmarkRoutes(b *testing.B, rt registrar) []*url.URL {
+	requests := make([]*url.URL, 0)
+	for i := 0; i < 1000; i++ {
+		rt.Register(mustParse(b, fmt.Sprintf("/api/service%d/items", i)), "GET", handlerOf(""))
+		rt.Register(mustParse(b, fmt.Sprintf("/api/service%d/items/:id", i)), "GET", handlerOf(""))
+		rt.Register(mustParse(b, fmt.Sprintf("/api/service%d/items/:id/children/:child", i)), "GET", handlerOf(""))
+		requests = append(requests, mustParse(b, fmt.Sprintf("/api/service%d/items/%d/children/%d", i, i, i)))
+	}
+	return requests
+}
+
+func BenchmarkRouteTableFind(b *testing.B) {
+	rt := NewRouteTable()
+	requests := benchmarkRoutes(b, rt)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rt.Find(requests[i%len(requests)], "GET"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLinearRouteTableFind(b *testing.B) {
+	rt := newLinearRouteTable()
+	requests := benchmarkRoutes(b, rt)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rt.Find(requests[i%len(requests)], "GET"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,12 +1,12 @@
 package gtw
 
 import (
-	"fmt"
 	"net/http"
 	"net/url"
-	"reflect"
 	"strings"
-	"unsafe"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 type (
@@ -22,6 +22,18 @@ type (
 		routeTable            *RouteTable
 		corsHandler           http.HandlerFunc
 		defaultResponseHeader http.Header
+		strict                bool
+		problems              bool
+		middleware            []Middleware
+		endpoints             []*endpoint
+		namedMiddleware       map[string]Middleware
+		lifecycle             lifecycle
+		panicHandler          PanicHandler
+		panicHooks            []func(report *PanicReport)
+		errorMapper           ErrorMapper
+		codecs                codecs
+		keepAlive             time.Duration
+		templates             *templateSet
 	}
 )
 
@@ -43,104 +55,96 @@ func New() *Server {
 	server.mux = mux
 	server.routeTable = NewRouteTable()
 	server.defaultResponseHeader = http.Header{}
+	server.strict = true
+	server.namedMiddleware = make(map[string]Middleware)
+	server.lifecycle.sockets = make(map[*websocket.Conn]struct{})
+	server.panicHandler = server.defaultPanicHandler
+	server.errorMapper = server.defaultErrorMapper
+	server.codecs = defaultCodecs()
+	server.keepAlive = _keepAlive
+	server.lifecycle.stopping = make(chan struct{})
 	server.corsHandler = func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 	}
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if !server.enter() {
+			w.Header().Set("Connection", "close")
+			server.fail(w, r, NewProblem(http.StatusServiceUnavailable, "server shutting down"))
+			return
+		}
+		defer server.lifecycle.active.Done()
 		if r.Method == http.MethodOptions {
-			_, err := server.routeTable.Find(r.URL, "*")
-			if err != nil {
-				http.NotFound(w, r)
+			methods := server.routeTable.Allowed(r.URL)
+			if len(methods) == 0 {
+				server.fail(w, r, NewProblem(http.StatusNotFound, ""))
+				return
+			}
+			if isPreflight(r) {
+				server.corsHandler(w, r)
 				return
 			}
-			server.corsHandler(w, r)
+			w.Header().Set("Allow", allow(methods))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		endpoint, params, err := server.routeTable.find(r.URL, r.Method)
+		if err == METHOD_NOT_ALLOWED {
+			methods := server.routeTable.Allowed(r.URL)
+			w.Header().Set("Allow", allow(methods))
+			server.fail(w, r, NewProblem(http.StatusMethodNotAllowed, "").With("allow", methods))
 			return
 		}
-		route, err := server.routeTable.Find(r.URL, r.Method)
 		if err != nil {
-			http.NotFound(w, r)
+			server.fail(w, r, NewProblem(http.StatusNotFound, ""))
 			return
 		}
 		for key := range server.defaultResponseHeader {
 			w.Header().Add(key, server.defaultResponseHeader.Get(key))
 		}
-		route.ServeHTTP(w, r)
+		endpoint.serveHTTP(&responseWriter{ResponseWriter: w, request: r, server: server}, r, params, endpoint.pipeline, server)
 	})
 	return server
 }
 
 func (srv *Server) Handle(route string, method string, handlerFunc Handler) error {
+	return srv.handle(route, &endpoint{
+		method:   method,
+		handler:  handlerFunc,
+		autoHead: true,
+	})
+}
+
+func (srv *Server) handle(route string, endpoint *endpoint) error {
 	url, err := url.Parse(route)
 	if err != nil {
 		return err
 	}
-	srv.routeTable.Register(url, method, handlerFunc)
+	endpoint.pipeline = chain(endpoint.handler, srv.middleware)
+	if err := srv.routeTable.register(url, endpoint); err != nil {
+		return err
+	}
+	srv.endpoints = append(srv.endpoints, endpoint)
 	return nil
 }
 
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mux.ServeHTTP(w, r)
+}
+
 func (srv *Server) ListenAndServe(server *http.Server) error {
 	server.Handler = srv.mux
+	srv.lifecycle.mut.Lock()
+	srv.lifecycle.server = server
+	srv.lifecycle.mut.Unlock()
 	return server.ListenAndServe()
 }
 
-func (srv *Server) Register(v any) error {
-	t := reflect.TypeOf(v)
-	if t.Kind() != reflect.Pointer {
-		return fmt.Errorf("expected pointer buy found value")
-	}
-	if t.Elem().Kind() != reflect.Struct {
-		return fmt.Errorf("expected struct but found %T", v)
-	}
-	val := reflect.ValueOf(v)
-	handlerType := reflect.TypeOf(func(*HttpCtx) (Status, Response) { return 0, nil })
-	metadataType := reflect.TypeOf(Metadata(0))
-	lenOfFields := t.Elem().NumField()
-	prefix := t.Elem().Name()
-	for i := 0; i < lenOfFields; i++ {
-		field := t.Elem().Field(i)
-		if field.Name == "Metadata" && field.Type.AssignableTo(metadataType) {
-			prefix = strings.TrimPrefix(field.Tag.Get("prefix"), "/")
-			continue
-		}
-		if field.Type.AssignableTo(handlerType) {
-			route, ok := field.Tag.Lookup("route")
-			if !ok {
-				route = field.Name
-			}
-			httpMethod, ok := field.Tag.Lookup("method")
-			if !ok {
-				httpMethod = "GET"
-			}
-			methodName := fmt.Sprintf("%sHandler", field.Name)
-			_, ok = t.MethodByName(methodName)
-			if !ok {
-				continue
-			}
-			method := val.MethodByName(methodName).Interface().(func(*HttpCtx) (Status, Response))
-			r := fmt.Sprintf("/%s/%s", strings.TrimSuffix(prefix, "/"), strings.TrimPrefix(route, "/"))
-			r = strings.TrimLeft(r, "/")
-			srv.Handle(fmt.Sprintf("/%s", r), httpMethod, method)
-			continue
-		}
-		if strings.HasPrefix(field.Type.Name(), "Service[") && field.Type.PkgPath() == "github.com/vedadiyan/gtw" {
-			rf := val.Elem().Field(i)
-			name, ok := field.Tag.Lookup("name")
-			if ok {
-				f := rf.FieldByName("name")
-				f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
-				f.Set(reflect.ValueOf(name))
-			}
-		}
-	}
-	return nil
-}
-
 func (s *Server) Cors(c *Cors) *Server {
 	s.defaultResponseHeader.Add("Access-Control-Expose-Headers", c.ExposedHeaders)
 	s.corsHandler = func(w http.ResponseWriter, r *http.Request) {
 		_, err := s.routeTable.Find(r.URL, "*")
 		if err != nil {
-			http.NotFound(w, r)
+			s.fail(w, r, NewProblem(http.StatusNotFound, ""))
 			return
 		}
 		w.Header().Add("access-control-allow-origin", c.AllowedOrigins)
@@ -152,6 +156,19 @@ func (s *Server) Cors(c *Cors) *Server {
 	return s
 }
 
+func isPreflight(r *http.Request) bool {
+	return len(r.Header.Get("Origin")) != 0 && len(r.Header.Get("Access-Control-Request-Method")) != 0
+}
+
+func allow(methods []string) string {
+	for _, method := range methods {
+		if method == http.MethodOptions {
+			return strings.Join(methods, ", ")
+		}
+	}
+	return strings.Join(append(methods, http.MethodOptions), ", ")
+}
+
 func CorsAllowAll() *Cors {
 	return &Cors{
 		AllowedOrigins: "*",
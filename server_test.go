@@ -1,9 +1,27 @@
 package gtw
 
 import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/vedadiyan/gtw/internal/di"
 )
 
@@ -36,7 +54,1320 @@ func TestParse(t *testing.T) {
 	if err != nil {
 		t.FailNow()
 	}
-	server.Cors(CorsAllowAll()).ListenAndServe(&http.Server{
-		Addr: ":8080",
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Cors(CorsAllowAll()).ListenAndServe(&http.Server{
+			Addr: addr,
+		})
+	}()
+	var response *http.Response
+	for i := 0; i < 100; i++ {
+		if response, err = http.Get("http://" + addr + "/api/test/x"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != 201 || response.Header.Get("x-test") != "ok" || string(body) != `{"Hello":0}` {
+		t.Fatalf("unexpected response %d %v %q", response.StatusCode, response.Header, body)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != http.ErrServerClosed {
+		t.Fatalf("expected %v but found %v", http.ErrServerClosed, err)
+	}
+}
+
+type (
+	UsersAPI struct {
+		Metadata `prefix:"users"`
+
+		Get    Handler `route:"/:id" method:"GET"`
+		Delete Handler `route:"/:id" method:"DELETE"`
+		Export Handler `route:"/:id/export" method:"GET" head:"off"`
+	}
+)
+
+func (u *UsersAPI) GetHandler(httpCtx *HttpCtx) (Status, Response) {
+	return 200, JSON(httpCtx.Request.RouteValues)
+}
+
+func (u *UsersAPI) DeleteHandler(httpCtx *HttpCtx) (Status, Response) {
+	return 204, Empty()
+}
+
+func (u *UsersAPI) ExportHandler(httpCtx *HttpCtx) (Status, Response) {
+	return 200, Raw([]byte("id,name"))
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	server := New()
+	if err := server.Register(new(UsersAPI)); err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("POST", "/users/1", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected %d but found %d", http.StatusMethodNotAllowed, recorder.Code)
+	}
+	if allow := recorder.Header().Get("Allow"); allow != "DELETE, GET, HEAD, OPTIONS" {
+		t.Fatalf("unexpected Allow header %q", allow)
+	}
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("OPTIONS", "/users/1", nil))
+	if recorder.Code != http.StatusNoContent || recorder.Header().Get("Allow") != "DELETE, GET, HEAD, OPTIONS" {
+		t.Fatalf("unexpected OPTIONS response %d %q", recorder.Code, recorder.Header().Get("Allow"))
+	}
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("POST", "/orders/1", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected %d but found %d", http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestHead(t *testing.T) {
+	server := New()
+	if err := server.Register(new(UsersAPI)); err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("HEAD", "/users/1", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d but found %d", http.StatusOK, recorder.Code)
+	}
+	if recorder.Body.Len() != 0 {
+		t.Fatalf("expected empty body but found %q", recorder.Body.String())
+	}
+	if recorder.Header().Get("Content-Length") != "10" || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected headers %v", recorder.Header())
+	}
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("HEAD", "/users/1/export", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected %d but found %d", http.StatusMethodNotAllowed, recorder.Code)
+	}
+}
+
+type (
+	AccountsAPI struct {
+		Metadata `prefix:"users"`
+
+		Get Handler `route:"/:uid" method:"GET"`
+	}
+)
+
+func (a *AccountsAPI) GetHandler(httpCtx *HttpCtx) (Status, Response) {
+	return 200, Empty()
+}
+
+func TestRegisterConflict(t *testing.T) {
+	server := New()
+	if err := server.Register(new(UsersAPI)); err != nil {
+		t.Fatal(err)
+	}
+	err := server.Register(new(AccountsAPI))
+	if err == nil {
+		t.Fatal("expected conflicting route to be rejected")
+	}
+	for _, source := range []string{"gtw.UsersAPI.Get", "gtw.AccountsAPI.Get"} {
+		if !strings.Contains(err.Error(), source) {
+			t.Fatalf("expected %q to mention %s", err.Error(), source)
+		}
+	}
+}
+
+type (
+	OrdersAPI struct {
+		Metadata `prefix:"orders"`
+
+		List   Handler `route:"/" method:"GET" handler:"ListOrders"`
+		Get    Handler `route:"/:id" method:"GET"`
+		Delete Handler `route:"/:id" method:"DELETE"`
+	}
+)
+
+func (o *OrdersAPI) ListOrders(httpCtx *HttpCtx) (Status, Response) {
+	return 200, JSON([]string{})
+}
+
+func (o *OrdersAPI) DeleteHandler(httpCtx *HttpCtx) Status {
+	return 204
+}
+
+func TestRegisterStrict(t *testing.T) {
+	err := New().Register(new(OrdersAPI))
+	if err == nil {
+		t.Fatal("expected missing and mis-typed handlers to be reported")
+	}
+	for _, field := range []string{"gtw.OrdersAPI.Get", "gtw.OrdersAPI.Delete"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Fatalf("expected %q to mention %s", err.Error(), field)
+		}
+	}
+	server := New().Strict(false)
+	if err := server.Register(new(OrdersAPI)); err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/orders", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d but found %d", http.StatusOK, recorder.Code)
+	}
+}
+
+type (
+	HealthAPI struct {
+		Health Handler `route:"/health" method:"GET"`
+	}
+	V1API struct {
+		Metadata `prefix:"v1"`
+
+		Users  UsersAPI
+		Orders *OrdersAPI
+	}
+	GatewayAPI struct {
+		Metadata `prefix:"api"`
+		HealthAPI
+
+		V1 V1API
+	}
+)
+
+func (h *HealthAPI) HealthHandler(httpCtx *HttpCtx) (Status, Response) {
+	return 200, Empty()
+}
+
+func TestRegisterNested(t *testing.T) {
+	server := New().Strict(false)
+	api := new(GatewayAPI)
+	if err := server.Register(api); err != nil {
+		t.Fatal(err)
+	}
+	if api.V1.Orders == nil {
+		t.Fatal("expected nil API pointer to be initialized")
+	}
+	for _, route := range []string{"/api/health", "/api/v1/users/1", "/api/v1/orders"} {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest("GET", route, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: expected %d but found %d", route, http.StatusOK, recorder.Code)
+		}
+	}
+}
+
+type (
+	AuditedAPI struct {
+		Metadata `prefix:"audited" middleware:"group"`
+
+		Get Handler `route:"/" method:"GET" middleware:"route"`
+	}
+	AuditedRootAPI struct {
+		Metadata `prefix:"root"`
+
+		Audited AuditedAPI
+	}
+)
+
+func (a *AuditedAPI) GetHandler(httpCtx *HttpCtx) (Status, Response) {
+	return 200, Empty()
+}
+
+func (a *AuditedRootAPI) Middleware() []Middleware {
+	return []Middleware{trace("parent")}
+}
+
+var (
+	_trace []string
+)
+
+func trace(name string) Middleware {
+	return func(next Handler) Handler {
+		return func(httpCtx *HttpCtx) (Status, Response) {
+			_trace = append(_trace, name)
+			return next(httpCtx)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	server := New()
+	server.AddMiddleware("group", trace("group")).AddMiddleware("route", trace("route"))
+	if err := server.Register(new(AuditedRootAPI)); err != nil {
+		t.Fatal(err)
+	}
+	server.Use(trace("global"))
+	_trace = nil
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/root/audited", nil))
+	if strings.Join(_trace, ",") != "global,parent,group,route" {
+		t.Fatalf("unexpected middleware order %v", _trace)
+	}
+	if err := New().Register(new(AuditedAPI)); err == nil {
+		t.Fatal("expected unknown middleware to be reported")
+	}
+
+	built := 0
+	server = New().Use(func(next Handler) Handler {
+		built++
+		return next
+	})
+	server.Handle("/counted", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, Empty()
+	})
+	for i := 0; i < 3; i++ {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/counted", nil))
+	}
+	if built != 1 {
+		t.Fatalf("expected the middleware chain to be built once but it was built %d times", built)
+	}
+}
+
+type (
+	SocketAPI struct {
+		Metadata `prefix:"ws"`
+
+		Connect Handler `route:"/" method:"GET"`
+	}
+)
+
+func (s *SocketAPI) ConnectHandler(httpCtx *HttpCtx) (Status, Response) {
+	conn, err := httpCtx.Upgrade(nil)
+	if err != nil {
+		return 400, Empty()
+	}
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return 0, func(int, http.ResponseWriter) {}
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	server := New()
+	if err := server.Register(new(SocketAPI)); err != nil {
+		t.Fatal(err)
+	}
+	hooks := make([]string, 0)
+	server.OnShutdown(func(ctx context.Context) error {
+		hooks = append(hooks, "first")
+		return nil
+	})
+	server.OnShutdown(func(ctx context.Context) error {
+		hooks = append(hooks, "second")
+		return nil
+	})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("expected going away close frame but found %v", err)
+	}
+	if strings.Join(hooks, ",") != "second,first" {
+		t.Fatalf("unexpected hook order %v", hooks)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/ws", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d after shutdown but found %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+}
+
+type (
+	SessionAPI struct {
+		Metadata `prefix:"session" timeout:"1m" middleware:"session"`
+
+		Get  Handler `route:"/" method:"GET"`
+		Fast Handler `route:"/fast" method:"GET" timeout:"10ms"`
+	}
+)
+
+func (s *SessionAPI) GetHandler(httpCtx *HttpCtx) (Status, Response) {
+	user, ok := GetValue[string](httpCtx, "user")
+	deadline, hasDeadline := httpCtx.Deadline()
+	if !ok || !hasDeadline || time.Until(deadline) < 30*time.Second {
+		return 500, Empty()
+	}
+	return 200, Raw([]byte(user))
+}
+
+func (s *SessionAPI) FastHandler(httpCtx *HttpCtx) (Status, Response) {
+	<-httpCtx.Done()
+	if httpCtx.Err() != context.DeadlineExceeded {
+		return 500, Empty()
+	}
+	return 503, Empty()
+}
+
+func TestContext(t *testing.T) {
+	server := New()
+	server.AddMiddleware("session", func(next Handler) Handler {
+		return func(httpCtx *HttpCtx) (Status, Response) {
+			httpCtx.Set("user", "alice")
+			return next(httpCtx)
+		}
+	})
+	if err := server.Register(new(SessionAPI)); err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/session", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "alice" {
+		t.Fatalf("unexpected response %d %q", recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/session/fast", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d but found %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+}
+
+type (
+	PanicAPI struct {
+		Metadata `prefix:"panic"`
+
+		Missing Service[string] `name:"missing"`
+
+		Get Handler `route:"/" method:"GET"`
+	}
+)
+
+func (p *PanicAPI) GetHandler(httpCtx *HttpCtx) (Status, Response) {
+	return 200, Raw([]byte(*p.Missing.Value()))
+}
+
+func TestRecover(t *testing.T) {
+	server := New()
+	var report *PanicReport
+	server.OnPanic(func(r *PanicReport) {
+		report = r
+	})
+	if err := server.Register(new(PanicAPI)); err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/panic", nil))
+	if recorder.Code != http.StatusInternalServerError || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d %v", recorder.Code, recorder.Header())
+	}
+	if report == nil || report.Source != "gtw.PanicAPI.Get" || report.Pattern != "/panic" || len(report.Stack) == 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	server.Recover(func(report *PanicReport) (Status, Response) {
+		return http.StatusServiceUnavailable, Empty()
+	})
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/panic", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d but found %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+}
+
+type (
+	ItemsAPI struct {
+		Metadata `prefix:"items"`
+
+		Get    Handler `route:"/:id" method:"GET"`
+		Delete Handler `route:"/:id" method:"DELETE"`
+	}
+)
+
+func (i *ItemsAPI) GetHandler(httpCtx *HttpCtx) (Response, error) {
+	if httpCtx.Request.RouteValues["id"] != "1" {
+		return nil, fmt.Errorf("item lookup failed: %w", &HttpError{Status: http.StatusNotFound, Message: "item not found"})
+	}
+	return JSON(map[string]any{"id": 1}), nil
+}
+
+func (i *ItemsAPI) DeleteHandler(httpCtx *HttpCtx) error {
+	if httpCtx.Request.RouteValues["id"] != "1" {
+		return fmt.Errorf("storage unavailable")
+	}
+	return nil
+}
+
+func TestErrorHandlers(t *testing.T) {
+	server := New()
+	if err := server.Register(new(ItemsAPI)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method string
+		route  string
+		status int
+		body   string
+	}{
+		{"GET", "/items/1", 200, `{"id":1}`},
+		{"GET", "/items/2", 404, `{"message":"item not found","status":404}`},
+		{"DELETE", "/items/1", 204, ``},
+		{"DELETE", "/items/2", 500, `{"message":"Internal Server Error","status":500}`},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(test.method, test.route, nil))
+		if recorder.Code != test.status || recorder.Body.String() != test.body {
+			t.Fatalf("%s %s: unexpected response %d %q", test.method, test.route, recorder.Code, recorder.Body.String())
+		}
+	}
+	server.MapError(func(httpCtx *HttpCtx, err error) (Status, Response) {
+		return http.StatusBadGateway, Raw([]byte(err.Error()))
+	})
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/items/2", nil))
+	if recorder.Code != http.StatusBadGateway || recorder.Body.String() != "storage unavailable" {
+		t.Fatalf("unexpected response %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+type (
+	GoneAPI struct {
+		Metadata `prefix:"gone"`
+
+		Get Handler `route:"/:id" method:"GET"`
+	}
+)
+
+var (
+	_errGone = NewProblem(http.StatusGone, "gone").With("reason", "archived")
+)
+
+func (g *GoneAPI) GetHandler(httpCtx *HttpCtx) error {
+	return _errGone
+}
+
+func TestProblems(t *testing.T) {
+	server := New().Problems(true)
+	for _, api := range []any{new(ItemsAPI), new(PanicAPI), new(GoneAPI)} {
+		if err := server.Register(api); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		method string
+		route  string
+		status int
+		body   string
+	}{
+		{"GET", "/unknown", 404, `{"instance":"/unknown","status":404,"title":"Not Found","type":"about:blank"}`},
+		{"POST", "/items/1", 405, `{"allow":["DELETE","GET","HEAD"],"instance":"/items/1","status":405,"title":"Method Not Allowed","type":"about:blank"}`},
+		{"GET", "/items/2", 404, `{"detail":"item not found","instance":"/items/2","status":404,"title":"Not Found","type":"about:blank"}`},
+		{"GET", "/panic", 500, `{"instance":"/panic","status":500,"title":"Internal Server Error","type":"about:blank"}`},
+		{"GET", "/gone/1", 410, `{"detail":"gone","instance":"/gone/1","reason":"archived","status":410,"title":"Gone","type":"about:blank"}`},
+		{"GET", "/gone/2", 410, `{"detail":"gone","instance":"/gone/2","reason":"archived","status":410,"title":"Gone","type":"about:blank"}`},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(test.method, test.route, nil))
+		if recorder.Code != test.status || recorder.Body.String() != test.body {
+			t.Fatalf("%s %s: unexpected response %d %q", test.method, test.route, recorder.Code, recorder.Body.String())
+		}
+		if recorder.Header().Get("Content-Type") != "application/problem+json" {
+			t.Fatalf("%s %s: unexpected content type %q", test.method, test.route, recorder.Header().Get("Content-Type"))
+		}
+	}
+	if len(_errGone.Instance) != 0 {
+		t.Fatalf("expected the shared problem to be left alone but found instance %q", _errGone.Instance)
+	}
+}
+
+type (
+	CreateUserRequest struct {
+		Id      int      `path:"id"`
+		Page    int      `query:"page"`
+		Tags    []string `query:"tag"`
+		Tenant  string   `header:"X-Tenant"`
+		Session string   `cookie:"session"`
+		Name    string   `json:"name"`
+	}
+	UserResponse struct {
+		Id      int      `json:"id"`
+		Page    int      `json:"page"`
+		Tags    []string `json:"tags"`
+		Tenant  string   `json:"tenant"`
+		Session string   `json:"session"`
+		Name    string   `json:"name"`
+	}
+	TypedAPI struct {
+		Metadata `prefix:"typed"`
+
+		Create Handler `route:"/:id<int>" method:"POST"`
+	}
+)
+
+func (a *TypedAPI) CreateHandler(httpCtx *HttpCtx, in *CreateUserRequest) (Status, *UserResponse) {
+	return http.StatusCreated, &UserResponse{
+		Id:      in.Id,
+		Page:    in.Page,
+		Tags:    in.Tags,
+		Tenant:  in.Tenant,
+		Session: in.Session,
+		Name:    in.Name,
+	}
+}
+
+type (
+	AmbiguousAPI struct {
+		Metadata `prefix:"ambiguous"`
+
+		Create Handler `route:"/" method:"POST"`
+	}
+)
+
+func (a *AmbiguousAPI) CreateHandler(httpCtx *HttpCtx, in *CreateUserRequest) (Status, error) {
+	return http.StatusBadRequest, errors.New("dropped")
+}
+
+func TestTypedHandler(t *testing.T) {
+	server := New()
+	if err := server.Register(new(TypedAPI)); err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest("POST", "/typed/7?page=2&tag=a&tag=b", strings.NewReader(`{"name":"alice"}`))
+	request.Header.Set("X-Tenant", "acme")
+	request.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	expected := `{"id":7,"page":2,"tags":["a","b"],"tenant":"acme","session":"s1","name":"alice"}`
+	if recorder.Code != http.StatusCreated || recorder.Body.String() != expected {
+		t.Fatalf("unexpected response %d %q", recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("POST", "/typed/7", strings.NewReader(`{"name":"bob","Tenant":"evil","Session":"forged","Page":9}`)))
+	expected = `{"id":7,"page":0,"tags":null,"tenant":"","session":"","name":"bob"}`
+	if recorder.Code != http.StatusCreated || recorder.Body.String() != expected {
+		t.Fatalf("expected the body to leave request fields alone but found %d %q", recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("POST", "/typed/7?page=x", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d but found %d", http.StatusBadRequest, recorder.Code)
+	}
+	if err := New().Register(new(AmbiguousAPI)); err == nil || !strings.Contains(err.Error(), "unsupported signature") {
+		t.Fatalf("expected a (Status, error) handler to be rejected but found %v", err)
+	}
+}
+
+type (
+	AddressRequest struct {
+		City string `json:"city" validate:"required"`
+	}
+	SignupRequest struct {
+		Name      string            `json:"name" validate:"required,min=1,max=8"`
+		Email     string            `json:"email" validate:"email"`
+		Plan      string            `json:"plan" validate:"oneof=free pro"`
+		Code      string            `json:"code" validate:"regex=^[A-Z]{3}$"`
+		Addresses []*AddressRequest `json:"addresses"`
+	}
+	SignupAPI struct {
+		Metadata `prefix:"signup"`
+
+		Create Handler `route:"/" method:"POST"`
+	}
+)
+
+func (a *SignupAPI) CreateHandler(httpCtx *HttpCtx, in *SignupRequest) (Status, *SignupRequest) {
+	return http.StatusCreated, in
+}
+
+func TestValidate(t *testing.T) {
+	server := New()
+	if err := server.Register(new(SignupAPI)); err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("POST", "/signup", strings.NewReader(`{"name":"alice","email":"a@b.co","plan":"pro","code":"ABC","addresses":[{"city":"x"}]}`)))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected response %d %q", recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("POST", "/signup", strings.NewReader(`{"email":"nope","plan":"gold","code":"abc","addresses":[{"city":"x"},{}]}`)))
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected %d but found %d", http.StatusUnprocessableEntity, recorder.Code)
+	}
+	for _, pointer := range []string{`"/name"`, `"/email"`, `"/plan"`, `"/code"`, `"/addresses/1/city"`} {
+		if !strings.Contains(recorder.Body.String(), pointer) {
+			t.Fatalf("expected %s in %q", pointer, recorder.Body.String())
+		}
+	}
+	var validationErrors ValidationErrors
+	err := Validate(&SignupRequest{Name: "toolongname"})
+	if !errors.As(err, &validationErrors) || len(validationErrors) != 1 || validationErrors[0].Rule != "max" {
+		t.Fatalf("unexpected validation result %v", err)
+	}
+	type AgeRequest struct {
+		Age   int  `json:"age" validate:"min=18"`
+		Limit *int `json:"limit" validate:"min=1"`
+	}
+	err = Validate(&AgeRequest{})
+	if !errors.As(err, &validationErrors) || len(validationErrors) != 1 || validationErrors[0].Pointer != "/age" {
+		t.Fatalf("expected a zero age to fail min but found %v", err)
+	}
+}
+
+type (
+	SearchQuery struct {
+		Term    string            `query:"q" validate:"required"`
+		Page    int               `default:"1"`
+		Size    *int              `query:"size"`
+		Tags    []string          `query:"tag"`
+		Ids     []int             `query:"id"`
+		Filter  map[string]int    `query:"filter"`
+		Labels  map[string]string `query:"label"`
+		Sort    string            `query:"sort" default:"name"`
+		Ignored string            `query:"-"`
+	}
+)
+
+func TestQuery(t *testing.T) {
+	var search SearchQuery
+	request := httptest.NewRequest("GET", "/?q=go&size=5&tag=a,b&tag=c&id=1&id=2,3&filter[min]=2&filter[max]=9&label[env]=prod&Ignored=x", nil)
+	httpCtx := &HttpCtx{}
+	httpCtx.Request.Reader = (*Reader)(request)
+	if err := httpCtx.Query().Unmarshal(&search); err != nil {
+		t.Fatal(err)
+	}
+	actual := fmt.Sprintf("%s %d %d %v %v %v %v %s %q", search.Term, search.Page, *search.Size, search.Tags, search.Ids, search.Filter, search.Labels, search.Sort, search.Ignored)
+	expected := `go 1 5 [a b c] [1 2 3] map[max:9 min:2] map[env:prod] name ""`
+	if actual != expected {
+		t.Fatalf("expected %s but found %s", expected, actual)
+	}
+	tests := map[string]string{
+		"/?q=go&Page=x":        "`Page`",
+		"/?q=go&id=1,x":        "`id`",
+		"/?q=go&filter[min]=x": "`filter[min]`",
+		"/?page=1":             "/Term",
+	}
+	for route, expected := range tests {
+		httpCtx.Request.Reader = (*Reader)(httptest.NewRequest("GET", route, nil))
+		err := httpCtx.Query().Unmarshal(&SearchQuery{})
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("%s: expected an error mentioning %s but found %v", route, expected, err)
+		}
+	}
+}
+
+type (
+	UploadRequest struct {
+		Title  string                  `form:"title" validate:"required"`
+		Tags   []string                `form:"tag"`
+		Avatar *multipart.FileHeader   `file:"avatar"`
+		Extras []*multipart.FileHeader `file:"extra"`
+	}
+	StreamRequest struct {
+		Title  string      `form:"title"`
+		Avatar FileHandler `file:"avatar"`
+	}
+	UploadAPI struct {
+		Metadata `prefix:"upload"`
+
+		Create Handler `route:"/" method:"POST" multipart:"memory=1KB,parts=4,file=8B"`
+	}
+)
+
+func (a *UploadAPI) CreateHandler(httpCtx *HttpCtx, in *UploadRequest) (Status, Response) {
+	file, err := in.Avatar.Open()
+	if err != nil {
+		return http.StatusInternalServerError, Empty()
+	}
+	defer file.Close()
+	data, _ := io.ReadAll(file)
+	return http.StatusOK, Raw([]byte(fmt.Sprintf("%s %v %s %s %d", in.Title, in.Tags, in.Avatar.Filename, data, len(in.Extras))))
+}
+
+func multipartBody(t *testing.T, files map[string]string, values ...string) (*bytes.Buffer, string) {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	for i := 0; i+1 < len(values); i += 2 {
+		writer.WriteField(values[i], values[i+1])
+	}
+	for name, content := range files {
+		part, err := writer.CreateFormFile(name, name+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(content))
+	}
+	writer.Close()
+	return body, writer.FormDataContentType()
+}
+
+type countingReader struct {
+	reader io.Reader
+	read   int
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.read += n
+	return n, err
+}
+
+func TestForm(t *testing.T) {
+	server := New()
+	if err := server.Register(new(UploadAPI)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		files  map[string]string
+		values []string
+		status int
+		body   string
+	}{
+		{map[string]string{"avatar": "image"}, []string{"title", "me", "tag", "a"}, http.StatusOK, "me [a] avatar.txt image 0"},
+		{map[string]string{"avatar": "a much larger image"}, []string{"title", "me"}, http.StatusRequestEntityTooLarge, ""},
+		{map[string]string{"avatar": "image"}, []string{"title", "me", "tag", "a", "tag", "b", "tag", "c"}, http.StatusRequestEntityTooLarge, ""},
+		{map[string]string{"avatar": "image"}, nil, http.StatusUnprocessableEntity, ""},
+	}
+	for _, test := range tests {
+		body, contentType := multipartBody(t, test.files, test.values...)
+		request := httptest.NewRequest("POST", "/upload", body)
+		request.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		if recorder.Code != test.status || (len(test.body) != 0 && recorder.Body.String() != test.body) {
+			t.Fatalf("%v: unexpected response %d %q", test.values, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	body, contentType := multipartBody(t, map[string]string{"avatar": "streamed"}, "title", "me")
+	request := httptest.NewRequest("POST", "/", body)
+	request.Header.Set("Content-Type", contentType)
+	var streamed string
+	stream := StreamRequest{Avatar: func(header *multipart.FileHeader, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		streamed = header.Filename + " " + string(data)
+		return err
+	}}
+	if err := (*Reader)(request).Unmarshal(&stream); err != nil || stream.Title != "me" || streamed != "avatar.txt streamed" {
+		t.Fatalf("unexpected stream result %v %q %q", err, stream.Title, streamed)
+	}
+
+	body, contentType = multipartBody(t, map[string]string{"avatar": "streamed"}, "title", "me")
+	request = httptest.NewRequest("POST", "/", body)
+	request.Header.Set("Content-Type", contentType)
+	var problem *ProblemDetails
+	if err := (*Reader)(request).Unmarshal(new(StreamRequest)); !errors.As(err, &problem) || problem.Status != http.StatusBadRequest {
+		t.Fatalf("expected a file without a handler to be rejected but found %v", err)
+	}
+
+	body, contentType = multipartBody(t, map[string]string{"avatar": strings.Repeat("x", 5<<20)}, "title", "me")
+	counter := &countingReader{reader: body}
+	request = httptest.NewRequest("POST", "/upload", counter)
+	request.Header.Set("Content-Type", contentType)
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusRequestEntityTooLarge || counter.read > 64<<10 {
+		t.Fatalf("expected an early 413 but found %d after reading %d bytes", recorder.Code, counter.read)
+	}
+
+	request = httptest.NewRequest("POST", "/", strings.NewReader("title=me&tag=a,b"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var form UploadRequest
+	if err := (*Reader)(request).Unmarshal(&form); err != nil || form.Title != "me" || fmt.Sprint(form.Tags) != "[a b]" {
+		t.Fatalf("unexpected form result %v %+v", err, form)
+	}
+}
+
+type (
+	textCodec   struct{}
+	NoteRequest struct {
+		Text string `json:"text" xml:"text"`
+	}
+	NoteAPI struct {
+		Metadata `prefix:"notes"`
+
+		Create Handler `route:"/" method:"POST"`
+	}
+)
+
+func (textCodec) Marshal(v any) ([]byte, error) {
+	return []byte(strings.ToUpper(v.(*NoteRequest).Text)), nil
+}
+
+func (textCodec) Unmarshal(data []byte, v any) error {
+	v.(*NoteRequest).Text = string(data)
+	return nil
+}
+
+func (a *NoteAPI) CreateHandler(httpCtx *HttpCtx, in *NoteRequest) (Status, Response) {
+	return http.StatusOK, Encode(httpCtx.Request.Header.Get("Accept"), in)
+}
+
+func TestCodecs(t *testing.T) {
+	server := New().Codec("text/x-note", textCodec{})
+	if err := server.Register(new(NoteAPI)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		contentType string
+		accept      string
+		body        string
+		status      int
+		expected    string
+	}{
+		{"application/json", "application/json", `{"text":"hi"}`, http.StatusOK, `{"text":"hi"}`},
+		{"application/xml; charset=utf-8", "application/xml", `<NoteRequest><text>hi</text></NoteRequest>`, http.StatusOK, `<NoteRequest><text>hi</text></NoteRequest>`},
+		{"application/vnd.note+json", "text/x-note", `{"text":"hi"}`, http.StatusOK, `HI`},
+		{"text/x-note", "application/json", `hi`, http.StatusOK, `{"text":"hi"}`},
+		{"application/yaml", "application/json", `text: hi`, http.StatusUnsupportedMediaType, ""},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("POST", "/notes", strings.NewReader(test.body))
+		request.Header.Set("Content-Type", test.contentType)
+		request.Header.Set("Accept", test.accept)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		if recorder.Code != test.status || (len(test.expected) != 0 && recorder.Body.String() != test.expected) {
+			t.Fatalf("%s: unexpected response %d %q", test.contentType, recorder.Code, recorder.Body.String())
+		}
+		if test.status == http.StatusOK && recorder.Header().Get("Content-Type") != test.accept {
+			t.Fatalf("%s: unexpected content type %q", test.contentType, recorder.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	server := New().Codec("text/x-note", textCodec{})
+	server.Handle("/notes/:text", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, Negotiate(&NoteRequest{Text: httpCtx.Request.RouteValues["text"].(string)})
+	})
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"", http.StatusOK, "application/json"},
+		{"*/*", http.StatusOK, "application/json"},
+		{"text/*", http.StatusOK, "text/x-note"},
+		{"application/xml;q=0.9, text/x-note;q=0.5", http.StatusOK, "application/xml"},
+		{"application/json;q=0, */*;q=0.1", http.StatusOK, "application/xml"},
+		{"application/vnd.note+json", http.StatusNotAcceptable, ""},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8", http.StatusOK, "application/json"},
+		{"text/csv", http.StatusNotAcceptable, ""},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/notes/hi", nil)
+		request.Header.Set("Accept", test.accept)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		if recorder.Code != test.status || recorder.Header().Get("Vary") != "Accept" {
+			t.Fatalf("%q: unexpected response %d %v", test.accept, recorder.Code, recorder.Header())
+		}
+		if len(test.contentType) != 0 && recorder.Header().Get("Content-Type") != test.contentType {
+			t.Fatalf("%q: expected %s but found %s", test.accept, test.contentType, recorder.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	server := New().EventStreamKeepAlive(10 * time.Millisecond)
+	ended := make(chan error, 1)
+	server.Handle("/feed", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		events := make(chan *Event, 2)
+		events <- &Event{Id: "1", Event: "greeting", Data: "hello\nworld", Retry: time.Second}
+		events <- &Event{Id: "2", Data: map[string]int{"count": 2}}
+		close(events)
+		return http.StatusOK, SSE(events)
+	})
+	server.Handle("/live", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		stream, err := httpCtx.EventStream()
+		if err != nil {
+			return http.StatusInternalServerError, Empty()
+		}
+		stream.Send(&Event{Id: stream.LastEventId, Data: "resumed"})
+		<-stream.Done()
+		ended <- stream.Err()
+		return 0, NoResponse()
+	})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	response, err := http.Get(httpServer.URL + "/feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	expected := "id: 1\nevent: greeting\nretry: 1000\ndata: hello\ndata: world\n\nid: 2\ndata: {\"count\":2}\n\n"
+	if response.Header.Get("Content-Type") != "text/event-stream" || string(body) != expected {
+		t.Fatalf("unexpected stream %v %q", response.Header, body)
+	}
+	for _, route := range []string{"/feed", "/live"} {
+		response, err := http.Head(httpServer.URL + route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("HEAD %s: unexpected response %d %v", route, response.StatusCode, response.Header)
+		}
+	}
+	if err := <-ended; err != ErrEventStreamClosed {
+		t.Fatalf("expected %v but found %v", ErrEventStreamClosed, err)
+	}
+
+	request, _ := http.NewRequest("GET", httpServer.URL+"/live", nil)
+	request.Header.Set("Last-Event-ID", "41")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	reader := bufio.NewReader(response.Body)
+	lines := make([]string, 0)
+	for len(lines) < 4 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if strings.Join(lines, "") != "id: 41\ndata: resumed\n\n: keep-alive\n" {
+		t.Fatalf("unexpected stream %q", lines)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-ended; err != http.ErrServerClosed {
+		t.Fatalf("expected %v but found %v", http.ErrServerClosed, err)
+	}
+
+	server = New().EventStreamKeepAlive(0)
+	server.Handle("/feed", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		events := make(chan *Event, 1)
+		events <- &Event{Data: "quiet"}
+		close(events)
+		return http.StatusOK, SSE(events)
+	})
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/feed", nil))
+	if recorder.Body.String() != "data: quiet\n\n" {
+		t.Fatalf("unexpected stream without keep-alive %q", recorder.Body.String())
+	}
+}
+
+func TestStream(t *testing.T) {
+	server := New()
+	aborted := make(chan error, 1)
+	server.Handle("/export", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, WithHeader(Stream(strings.NewReader("a,b\n1,2\n")), http.Header{"Content-Type": {"text/csv"}})
+	})
+	server.Handle("/items", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		items := make(chan int)
+		go func() {
+			defer close(items)
+			for i := 1; i <= 3; i++ {
+				items <- i
+			}
+		}()
+		return http.StatusOK, NDJSON(items)
+	})
+	server.Handle("/fail/:when", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, StreamFunc(func(w io.Writer) error {
+			if httpCtx.Request.RouteValues["when"] == "late" {
+				io.WriteString(w, "partial")
+			}
+			return fmt.Errorf("export failed")
+		})
+	})
+	server.Handle("/endless", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, StreamFunc(func(w io.Writer) error {
+			for {
+				if _, err := io.WriteString(w, "tick\n"); err != nil {
+					aborted <- err
+					return err
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	tests := []struct {
+		route       string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"/export", http.StatusOK, "text/csv", "a,b\n1,2\n"},
+		{"/items", http.StatusOK, "application/x-ndjson", "1\n2\n3\n"},
+		{"/fail/early", http.StatusInternalServerError, "", "export failed\n"},
+	}
+	for _, test := range tests {
+		response, err := http.Get(httpServer.URL + test.route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		if response.StatusCode != test.status || string(body) != test.body || (len(test.contentType) != 0 && response.Header.Get("Content-Type") != test.contentType) {
+			t.Fatalf("%s: unexpected response %d %v %q", test.route, response.StatusCode, response.Header, body)
+		}
+	}
+	response, err := http.Get(httpServer.URL + "/fail/late")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(response.Body); err == nil {
+		t.Fatal("expected a failing stream to abort the response")
+	}
+	response.Body.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	request, _ := http.NewRequestWithContext(ctx, "GET", httpServer.URL+"/endless", nil)
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bufio.NewReader(response.Body).ReadString('\n')
+	cancel()
+	response.Body.Close()
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stream to stop after the client disconnected")
+	}
+}
+
+type (
+	AssetsAPI struct {
+		Metadata `prefix:"site"`
+
+		Public fs.FS `static:"/public"`
+	}
+)
+
+func TestStatic(t *testing.T) {
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"index.html":      {Data: []byte("<html>home</html>"), ModTime: modTime},
+		"app.js":          {Data: []byte("console.log(1)"), ModTime: modTime},
+		"app.js.gz":       {Data: []byte("gzipped"), ModTime: modTime},
+		"blob":            {Data: []byte("%PDF-1.4 blob"), ModTime: modTime},
+		"docs/index.html": {Data: []byte("<html>docs</html>"), ModTime: modTime},
+	}
+	server := New()
+	if err := server.Static("/assets", fsys); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SPA("/app", fsys); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Register(&AssetsAPI{Public: fsys}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "report.txt")
+	os.WriteFile(path, []byte("report"), 0o600)
+	server.Handle("/report", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, File(path)
 	})
+	etag := fmt.Sprintf(`W/"%x-%x"`, len("console.log(1)"), modTime.UnixNano())
+	tests := []struct {
+		route       string
+		header      http.Header
+		status      int
+		contentType string
+		body        string
+	}{
+		{"/assets/app.js", nil, http.StatusOK, "text/javascript; charset=utf-8", "console.log(1)"},
+		{"/assets/app.js", http.Header{"If-None-Match": {etag}}, http.StatusNotModified, "", ""},
+		{"/assets/app.js", http.Header{"If-Modified-Since": {modTime.Format(http.TimeFormat)}}, http.StatusNotModified, "", ""},
+		{"/assets/app.js", http.Header{"Range": {"bytes=0-6"}}, http.StatusPartialContent, "", "console"},
+		{"/assets/app.js", http.Header{"Accept-Encoding": {"br;q=0, gzip"}}, http.StatusOK, "text/javascript; charset=utf-8", "gzipped"},
+		{"/assets/blob", nil, http.StatusOK, "application/pdf", "%PDF-1.4 blob"},
+		{"/assets", nil, http.StatusOK, "text/html; charset=utf-8", "<html>home</html>"},
+		{"/assets/docs/", nil, http.StatusOK, "text/html; charset=utf-8", "<html>docs</html>"},
+		{"/assets/missing", nil, http.StatusNotFound, "", ""},
+		{"/app/users/42", nil, http.StatusOK, "text/html; charset=utf-8", "<html>home</html>"},
+		{"/app/missing.js", nil, http.StatusNotFound, "", ""},
+		{"/site/public/app.js", nil, http.StatusOK, "", "console.log(1)"},
+		{"/report", nil, http.StatusOK, "text/plain; charset=utf-8", "report"},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", test.route, nil)
+		for key, values := range test.header {
+			request.Header[key] = values
+		}
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		if recorder.Code != test.status || (len(test.body) != 0 && recorder.Body.String() != test.body) {
+			t.Fatalf("%s %v: unexpected response %d %q", test.route, test.header, recorder.Code, recorder.Body.String())
+		}
+		if len(test.contentType) != 0 && recorder.Header().Get("Content-Type") != test.contentType {
+			t.Fatalf("%s %v: unexpected content type %q", test.route, test.header, recorder.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestResponseBuilders(t *testing.T) {
+	server := New()
+	dir := t.TempDir()
+	files := map[string]string{
+		"layouts/base.html":    `<main>{{template "content" .}}</main>{{template "partials/footer.html" .}}`,
+		"partials/footer.html": `<footer>{{upper .Site}}</footer>`,
+		"users/show.html":      `{{define "content"}}<h1>{{.Name}}</h1>{{end}}{{template "layouts/base.html" .}}`,
+		"home.html":            `{{define "content"}}home{{end}}{{template "layouts/base.html" .}}`,
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o700)
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600)
+	}
+	err := server.Templates(&Templates{
+		FS:     os.DirFS(dir),
+		Funcs:  map[string]any{"upper": strings.ToUpper},
+		Reload: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Handle("/users/:name", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, HTML("users/show.html", map[string]any{"Name": httpCtx.Request.RouteValues["name"], "Site": "gtw"})
+	})
+	server.Handle("/home", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, HTML("home.html", map[string]any{"Site": "gtw"})
+	})
+	server.Handle("/missing", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, HTML("missing.html", nil)
+	})
+	server.Handle("/login", "POST", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, SetCookie(Redirect("home", http.StatusSeeOther), &http.Cookie{Name: "session", Value: "s1"})
+	})
+	serve := func(method string, route string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(method, route, nil))
+		return recorder
+	}
+	if recorder := serve("GET", "/users/<alice>"); recorder.Body.String() != "<main><h1>&lt;alice&gt;</h1></main><footer>GTW</footer>" || recorder.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("unexpected page %q", recorder.Body.String())
+	}
+	if recorder := serve("GET", "/home"); recorder.Body.String() != "<main>home</main><footer>GTW</footer>" {
+		t.Fatalf("unexpected page %q", recorder.Body.String())
+	}
+	os.WriteFile(filepath.Join(dir, "home.html"), []byte(`{{define "content"}}reloaded{{end}}{{template "layouts/base.html" .}}`), 0o600)
+	if recorder := serve("GET", "/home"); recorder.Body.String() != "<main>reloaded</main><footer>GTW</footer>" {
+		t.Fatalf("expected the template to be reloaded but found %q", recorder.Body.String())
+	}
+	if recorder := serve("GET", "/missing"); recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("expected %d but found %d", http.StatusInternalServerError, recorder.Code)
+	}
+	recorder := serve("POST", "/login")
+	if recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != "/home" || recorder.Header().Get("Set-Cookie") != "session=s1" {
+		t.Fatalf("unexpected redirect %d %v", recorder.Code, recorder.Header())
+	}
+}
+
+type (
+	CompressedAPI struct {
+		Metadata `prefix:"zip"`
+
+		Large Handler `route:"/large"`
+		Plain Handler `route:"/plain" compress:"off"`
+	}
+)
+
+func (a *CompressedAPI) LargeHandler(httpCtx *HttpCtx) (Status, Response) {
+	return http.StatusOK, JSON(map[string]string{"data": strings.Repeat("a", 2048)})
+}
+
+func (a *CompressedAPI) PlainHandler(httpCtx *HttpCtx) (Status, Response) {
+	return http.StatusOK, Raw([]byte(strings.Repeat("b", 2048)))
+}
+
+func TestCompress(t *testing.T) {
+	server := New().Use(Compress(1024))
+	if err := server.Register(new(CompressedAPI)); err != nil {
+		t.Fatal(err)
+	}
+	large := fmt.Sprintf(`{"data":"%s"}`, strings.Repeat("a", 2048))
+	server.Handle("/small", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, Raw([]byte("tiny"))
+	})
+	server.Handle("/image", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, WithHeader(Raw(make([]byte, 2048)), http.Header{"Content-Type": {"image/png"}})
+	})
+	server.Handle("/stream", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		events := make(chan *Event, 1)
+		events <- &Event{Data: "compressed"}
+		close(events)
+		return http.StatusOK, SSE(events)
+	})
+	server.Handle("/panic", "GET", func(httpCtx *HttpCtx) (Status, Response) {
+		return http.StatusOK, func(status int, w http.ResponseWriter) {
+			w.WriteHeader(status)
+			w.Write([]byte("partial"))
+			panic("broken response")
+		}
+	})
+	tests := []struct {
+		route    string
+		accept   string
+		encoding string
+		body     string
+	}{
+		{"/zip/large", "gzip, deflate", "gzip", large},
+		{"/zip/large", "gzip;q=0.5, deflate", "deflate", large},
+		{"/zip/large", "br", "", large},
+		{"/zip/large", "*, gzip;q=0", "deflate", large},
+		{"/zip/plain", "gzip", "", strings.Repeat("b", 2048)},
+		{"/small", "gzip", "", "tiny"},
+		{"/image", "gzip", "", string(make([]byte, 2048))},
+		{"/stream", "gzip", "gzip", "data: compressed\n\n"},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", test.route, nil)
+		request.Header.Set("Accept-Encoding", test.accept)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		if recorder.Header().Get("Content-Encoding") != test.encoding {
+			t.Fatalf("%s %s: expected encoding %q but found %q", test.route, test.accept, test.encoding, recorder.Header().Get("Content-Encoding"))
+		}
+		if vary := recorder.Header().Get("Vary"); (test.route == "/zip/plain") == (vary == "Accept-Encoding") {
+			t.Fatalf("%s %s: unexpected Vary %q", test.route, test.accept, vary)
+		}
+		var body io.Reader = recorder.Body
+		switch test.encoding {
+		case "gzip":
+			reader, err := gzip.NewReader(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = reader
+		case "deflate":
+			body = flate.NewReader(body)
+		}
+		data, err := io.ReadAll(body)
+		if err != nil || string(data) != test.body {
+			t.Fatalf("%s %s: unexpected body %v %q", test.route, test.accept, err, data)
+		}
+	}
+	request := httptest.NewRequest("GET", "/panic", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusInternalServerError || strings.Contains(recorder.Body.String(), "partial") {
+		t.Fatalf("expected a panicking response to be answered with 500 but found %d %q", recorder.Code, recorder.Body.String())
+	}
 }
@@ -0,0 +1,229 @@
+package gtw
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Event is a single Server-Sent Event. Data is written as is when it is a
+	// string or []byte and encoded as JSON otherwise. Multi-line data is split
+	// over several `data:` lines.
+	Event struct {
+		Id    string
+		Event string
+		Data  any
+		Retry time.Duration
+	}
+	// EventStream writes Server-Sent Events to a client. It is safe for
+	// concurrent use and ends when the client disconnects, the server shuts
+	// down, the handler returns or Close is called, whichever comes first.
+	EventStream struct {
+		// LastEventId is the `Last-Event-ID` header sent by a reconnecting
+		// client, used to resume the stream after the last event it received.
+		LastEventId string
+		writer      http.ResponseWriter
+		flusher     http.Flusher
+		codecs      codecs
+		done        chan struct{}
+		err         error
+		mut         sync.Mutex
+		once        sync.Once
+	}
+)
+
+var (
+	ErrEventStreamClosed = errors.New("event stream closed")
+	_keepAlive           = 15 * time.Second
+)
+
+// EventStream starts a Server-Sent Events response. The handler keeps
+// sending events until Done is closed; the stream is closed automatically
+// when the handler returns, which should then return NoResponse. For HEAD
+// requests only the headers are sent and the stream starts out closed.
+func (httpCtx *HttpCtx) EventStream() (*EventStream, error) {
+	stream, err := openEventStream(httpCtx.Response, (*http.Request)(httpCtx.Request.Reader), httpCtx.server, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	httpCtx.mut.Lock()
+	defer httpCtx.mut.Unlock()
+	httpCtx.streams = append(httpCtx.streams, stream)
+	return stream, nil
+}
+
+// SSE streams events as Server-Sent Events until the channel is closed, the
+// client disconnects or the server shuts down. Handlers resuming a stream can
+// read the `Last-Event-ID` request header to decide where events start.
+func SSE(events <-chan *Event) func(status int, w http.ResponseWriter) {
+	return func(status int, w http.ResponseWriter) {
+		var r *http.Request
+		var server *Server
+		if writer, ok := unwrap(w); ok {
+			r, server = writer.request, writer.server
+		}
+		stream, err := openEventStream(w, r, server, status)
+		if err != nil {
+			writeError(w, NewProblem(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		defer stream.Close()
+		for {
+			select {
+			case <-stream.Done():
+				return
+			case event, ok := <-events:
+				if !ok || stream.Send(event) != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// EventStreamKeepAlive sets how often idle event streams send a comment to
+// keep proxies from closing the connection. It defaults to 15 seconds; zero
+// or a negative interval disables keep-alive comments.
+func (srv *Server) EventStreamKeepAlive(interval time.Duration) *Server {
+	srv.keepAlive = interval
+	return srv
+}
+
+func openEventStream(w http.ResponseWriter, r *http.Request, server *Server, status int) (*EventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	head := r != nil && r.Method == http.MethodHead
+	if !ok && !head {
+		return nil, errors.New("response writer does not support flushing")
+	}
+	stream := &EventStream{
+		writer:  w,
+		flusher: flusher,
+		codecs:  _codecs,
+		done:    make(chan struct{}),
+	}
+	ctx, keepAlive := context.Background(), _keepAlive
+	var shutdown chan struct{}
+	if r != nil {
+		ctx, stream.LastEventId = r.Context(), r.Header.Get("Last-Event-ID")
+	}
+	if server != nil {
+		stream.codecs, keepAlive, shutdown = server.codecs, server.keepAlive, server.lifecycle.stopping
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(status)
+	if head {
+		stream.close(ErrEventStreamClosed)
+		return stream, nil
+	}
+	flusher.Flush()
+	go func() {
+		var tick <-chan time.Time
+		if keepAlive > 0 {
+			ticker := time.NewTicker(keepAlive)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-stream.done:
+				return
+			case <-ctx.Done():
+				stream.close(ctx.Err())
+				return
+			case <-shutdown:
+				stream.close(http.ErrServerClosed)
+				return
+			case <-tick:
+				stream.write([]byte(": keep-alive\n\n"))
+			}
+		}
+	}()
+	return stream, nil
+}
+
+// Send writes and flushes event. It returns the reason the stream ended once
+// it is no longer open.
+func (stream *EventStream) Send(event *Event) error {
+	buffer := new(bytes.Buffer)
+	if len(event.Id) != 0 {
+		fmt.Fprintf(buffer, "id: %s\n", event.Id)
+	}
+	if len(event.Event) != 0 {
+		fmt.Fprintf(buffer, "event: %s\n", event.Event)
+	}
+	if event.Retry > 0 {
+		fmt.Fprintf(buffer, "retry: %d\n", event.Retry.Milliseconds())
+	}
+	if event.Data != nil {
+		data, err := stream.data(event.Data)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+			fmt.Fprintf(buffer, "data: %s\n", line)
+		}
+	}
+	buffer.WriteString("\n")
+	return stream.write(buffer.Bytes())
+}
+
+// Done is closed when the stream ends.
+func (stream *EventStream) Done() <-chan struct{} {
+	return stream.done
+}
+
+// Err reports why the stream ended, or nil while it is open.
+func (stream *EventStream) Err() error {
+	stream.mut.Lock()
+	defer stream.mut.Unlock()
+	return stream.err
+}
+
+func (stream *EventStream) Close() {
+	stream.close(ErrEventStreamClosed)
+}
+
+func (stream *EventStream) close(err error) {
+	stream.mut.Lock()
+	defer stream.mut.Unlock()
+	stream.once.Do(func() {
+		stream.err = err
+		close(stream.done)
+	})
+}
+
+func (stream *EventStream) write(data []byte) error {
+	stream.mut.Lock()
+	defer stream.mut.Unlock()
+	if stream.err != nil {
+		return stream.err
+	}
+	if _, err := stream.writer.Write(data); err != nil {
+		return err
+	}
+	stream.flusher.Flush()
+	return nil
+}
+
+func (stream *EventStream) data(value any) ([]byte, error) {
+	switch value := value.(type) {
+	case string:
+		return []byte(value), nil
+	case []byte:
+		return value, nil
+	}
+	codec, ok := stream.codecs.lookup("application/json")
+	if !ok {
+		return nil, errors.New("no codec registered for `application/json`")
+	}
+	return codec.Marshal(value)
+}
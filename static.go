@@ -0,0 +1,222 @@
+package gtw
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type (
+	osFS struct{}
+)
+
+var (
+	_fsType     = reflect.TypeOf((*fs.FS)(nil)).Elem()
+	_encodings  = []struct{ name, suffix string }{{"br", ".br"}, {"gzip", ".gz"}}
+	_osFS       = osFS{}
+	_indexName  = "index.html"
+	_staticPath = "filepath"
+)
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// File serves the file at path, answering Range, If-Modified-Since and
+// If-None-Match requests and preferring precompressed `.br` or `.gz`
+// siblings the client accepts. The Content-Type is derived from the
+// extension and sniffed from the content when the extension is unknown.
+func File(path string) func(status int, w http.ResponseWriter) {
+	return serveFile(_osFS, path, false)
+}
+
+// FS serves the file name from fsys like File does.
+func FS(fsys fs.FS, name string) func(status int, w http.ResponseWriter) {
+	return serveFile(fsys, cleanName(name), false)
+}
+
+// Static mounts fsys under prefix for GET and HEAD requests. Directories are
+// served through their index.html and never listed.
+func (srv *Server) Static(prefix string, fsys fs.FS) error {
+	return srv.static(prefix, fsys, false, "", nil)
+}
+
+// SPA mounts fsys under prefix like Static, but answers requests for missing
+// paths without a file extension with the root index.html so that client
+// side routes resolve to the single page application.
+func (srv *Server) SPA(prefix string, fsys fs.FS) error {
+	return srv.static(prefix, fsys, true, "", nil)
+}
+
+// registerStatic mounts an fs.FS field tagged `static:"/prefix"`. The
+// `spa:"on"` tag enables the index.html fallback of Server.SPA.
+func (srv *Server) registerStatic(val reflect.Value, field reflect.StructField, group *group) error {
+	source := fmt.Sprintf("%s.%s", val.Type().Elem().String(), field.Name)
+	if !field.Type.Implements(_fsType) {
+		return fmt.Errorf("%s: static field must implement fs.FS", source)
+	}
+	rf := val.Elem().FieldByIndex(field.Index)
+	if (rf.Kind() == reflect.Interface || rf.Kind() == reflect.Pointer) && rf.IsNil() {
+		return fmt.Errorf("%s: static field has no file system", source)
+	}
+	fsys := reflect.NewAt(rf.Type(), rf.Addr().UnsafePointer()).Elem().Interface().(fs.FS)
+	return srv.static(join(group.prefix, field.Tag.Get("static")), fsys, field.Tag.Get("spa") == "on", source, group.middleware)
+}
+
+func (srv *Server) static(prefix string, fsys fs.FS, spa bool, source string, middleware []Middleware) error {
+	handler := chain(func(httpCtx *HttpCtx) (Status, Response) {
+		name, _ := httpCtx.Request.RouteValues[_staticPath].(string)
+		return http.StatusOK, serveFile(fsys, cleanName(name), spa)
+	}, middleware)
+	for _, route := range []string{prefix, join(prefix, "*"+_staticPath)} {
+		err := srv.handle(route, &endpoint{
+			method:   http.MethodGet,
+			source:   source,
+			handler:  handler,
+			autoHead: true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func serveFile(fsys fs.FS, name string, spa bool) func(status int, w http.ResponseWriter) {
+	return func(status int, w http.ResponseWriter) {
+		r := &http.Request{Method: http.MethodGet, Header: http.Header{}}
+		if writer, ok := unwrap(w); ok {
+			r = writer.request
+		}
+		file, info, err := open(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) && spa && len(path.Ext(name)) == 0 {
+			name = _indexName
+			file, info, err = open(fsys, name)
+		}
+		if err != nil {
+			writeError(w, problemOf(err))
+			return
+		}
+		defer file.Close()
+		if info.IsDir() {
+			name = path.Join(name, _indexName)
+			if file, info, err = open(fsys, name); err != nil {
+				writeError(w, problemOf(err))
+				return
+			}
+			defer file.Close()
+		}
+		contentType := mime.TypeByExtension(path.Ext(name))
+		etag := etagOf(info, "")
+		addVary(w.Header(), "Accept-Encoding")
+		for _, encoding := range _encodings {
+			if !accepts(r.Header.Get("Accept-Encoding"), encoding.name) {
+				continue
+			}
+			compressed, compressedInfo, err := open(fsys, name+encoding.suffix)
+			if err != nil || compressedInfo.IsDir() {
+				continue
+			}
+			defer compressed.Close()
+			if len(contentType) == 0 {
+				contentType = sniff(file)
+			}
+			w.Header().Set("Content-Encoding", encoding.name)
+			file, info, etag = compressed, compressedInfo, etagOf(compressedInfo, encoding.name)
+			break
+		}
+		if len(contentType) != 0 {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("ETag", etag)
+		content, err := seekable(file)
+		if err != nil {
+			writeError(w, NewProblem(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		http.ServeContent(w, r, name, info.ModTime(), content)
+	}
+}
+
+func open(fsys fs.FS, name string) (fs.File, fs.FileInfo, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+// cleanName turns a request path into a valid fs.FS name.
+func cleanName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if len(name) == 0 {
+		return "."
+	}
+	return name
+}
+
+func etagOf(info fs.FileInfo, encoding string) string {
+	if len(encoding) == 0 {
+		return fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+	}
+	return fmt.Sprintf(`W/"%x-%x-%s"`, info.Size(), info.ModTime().UnixNano(), encoding)
+}
+
+// accepts reports whether the Accept-Encoding header allows encoding.
+func accepts(header string, encoding string) bool {
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) && strings.TrimSpace(name) != "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(value, 64)
+		}
+		return q > 0
+	}
+	return false
+}
+
+func sniff(file fs.File) string {
+	buffer := make([]byte, 512)
+	n, _ := io.ReadFull(file, buffer)
+	return http.DetectContentType(buffer[:n])
+}
+
+// seekable returns file as an io.ReadSeeker, reading it into memory when the
+// file system does not support seeking.
+func seekable(file fs.File) (io.ReadSeeker, error) {
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		return seeker, nil
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func problemOf(err error) *ProblemDetails {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return NewProblem(http.StatusNotFound, "")
+	case errors.Is(err, fs.ErrPermission):
+		return NewProblem(http.StatusForbidden, "")
+	}
+	return NewProblem(http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,116 @@
+package gtw
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+type (
+	// flushWriter flushes every write to the client and fails writes once the
+	// request context is done. The status is sent with the first write so a
+	// stream that fails before producing output can still report an error.
+	flushWriter struct {
+		writer  http.ResponseWriter
+		flusher http.Flusher
+		ctx     context.Context
+		status  int
+		started bool
+	}
+)
+
+// Stream copies r to the client in chunks, flushing each one, and closes r
+// when it is an io.Closer. Copying stops when the client disconnects.
+func Stream(r io.Reader) func(status int, w http.ResponseWriter) {
+	return StreamFunc(func(w io.Writer) error {
+		if closer, ok := r.(io.Closer); ok {
+			defer closer.Close()
+		}
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// NDJSON writes every item received from items as a line of JSON until the
+// channel is closed or the client disconnects. Producers should stop sending
+// once the request context is done.
+func NDJSON[T any](items <-chan T) func(status int, w http.ResponseWriter) {
+	return func(status int, w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		ctx := contextOf(w)
+		codec, _ := codecsOf(w).lookup("application/json")
+		StreamFunc(func(writer io.Writer) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case item, ok := <-items:
+					if !ok {
+						return nil
+					}
+					data, err := codec.Marshal(item)
+					if err != nil {
+						return err
+					}
+					if _, err := writer.Write(append(data, '\n')); err != nil {
+						return err
+					}
+				}
+			}
+		})(status, w)
+	}
+}
+
+// StreamFunc hands fn a writer that flushes every write to the client and
+// fails once the client disconnects. When fn fails before writing anything
+// the error is reported as a 500; when it fails midway the connection is
+// aborted so the client does not mistake the partial body for a complete one.
+func StreamFunc(fn func(w io.Writer) error) func(status int, w http.ResponseWriter) {
+	return func(status int, w http.ResponseWriter) {
+		writer := &flushWriter{writer: w, ctx: contextOf(w), status: status}
+		writer.flusher, _ = w.(http.Flusher)
+		err := fn(writer)
+		if err == nil {
+			writer.start()
+			return
+		}
+		if writer.ctx.Err() != nil {
+			return
+		}
+		if !writer.started {
+			writeError(w, NewProblem(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (w *flushWriter) Write(b []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	w.start()
+	n, err := w.writer.Write(b)
+	if err != nil {
+		return n, err
+	}
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	return n, nil
+}
+
+func (w *flushWriter) start() {
+	if !w.started {
+		w.started = true
+		w.writer.WriteHeader(w.status)
+	}
+}
+
+// contextOf returns the context of the request served through w, if any.
+func contextOf(w http.ResponseWriter) context.Context {
+	if writer, ok := unwrap(w); ok {
+		return writer.request.Context()
+	}
+	return context.Background()
+}
@@ -0,0 +1,384 @@
+package gtw
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	nodeKind int
+	node     struct {
+		kind       nodeKind
+		path       string
+		name       string
+		constraint *constraint
+		indices    string
+		children   []*node
+		params     []*node
+		wildcard   *node
+		catchAll   *node
+		endpoints  []*endpoint
+	}
+	endpoint struct {
+		pattern      string
+		method       string
+		source       string
+		handler      Handler
+		pipeline     Handler
+		autoHead     bool
+		timeout      time.Duration
+		limits       *limits
+		uncompressed bool
+	}
+	param struct {
+		key   string
+		value any
+	}
+	token struct {
+		kind       nodeKind
+		value      string
+		constraint *constraint
+	}
+)
+
+const (
+	staticNode nodeKind = iota
+	paramNode
+	wildcardNode
+	catchAllNode
+)
+
+func newNode() *node {
+	return &node{kind: staticNode}
+}
+
+// cleanPath collapses empty segments so that "/a//b/" and "/a/b" resolve to
+// the same route. Already clean paths are returned without allocating.
+func cleanPath(path string) string {
+	if isCleanPath(path) {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	buffer := strings.Builder{}
+	buffer.Grow(len(path) + 1)
+	for _, segment := range segments {
+		if len(segment) == 0 {
+			continue
+		}
+		buffer.WriteByte('/')
+		buffer.WriteString(segment)
+	}
+	if buffer.Len() == 0 {
+		return "/"
+	}
+	return buffer.String()
+}
+
+func isCleanPath(path string) bool {
+	if len(path) == 0 || path[0] != '/' {
+		return false
+	}
+	if path == "/" {
+		return true
+	}
+	if path[len(path)-1] == '/' {
+		return false
+	}
+	return !strings.Contains(path, "//")
+}
+
+func tokenize(path string) ([]token, error) {
+	tokens := make([]token, 0)
+	static := strings.Builder{}
+	static.WriteByte('/')
+	segments := strings.Split(cleanPath(path), "/")
+	for index, segment := range segments {
+		if len(segment) == 0 {
+			continue
+		}
+		var kind nodeKind
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			kind = paramNode
+		case segment == "*":
+			kind = wildcardNode
+		case strings.HasPrefix(segment, "*"):
+			if index != len(segments)-1 {
+				return nil, fmt.Errorf("catch-all segment `%s` must be the last segment of `%s`", segment, path)
+			}
+			kind = catchAllNode
+		default:
+			static.WriteString(segment)
+			static.WriteByte('/')
+			continue
+		}
+		name, constraint, err := parseParam(segment[1:])
+		if err != nil {
+			return nil, err
+		}
+		if constraint != nil && kind != paramNode {
+			return nil, fmt.Errorf("constraints are only supported on `:` parameters but found `%s`", segment)
+		}
+		tokens = append(tokens, token{kind: staticNode, value: static.String()})
+		tokens = append(tokens, token{kind: kind, value: name, constraint: constraint})
+		static.Reset()
+		static.WriteByte('/')
+	}
+	tail := strings.TrimSuffix(static.String(), "/")
+	if len(tokens) == 0 && len(tail) == 0 {
+		tail = "/"
+	}
+	if len(tail) != 0 {
+		tokens = append(tokens, token{kind: staticNode, value: tail})
+	}
+	return tokens, nil
+}
+
+// shape renders tokens with parameter names erased. Two routes with the same
+// shape can never be told apart while matching.
+func shape(tokens []token) string {
+	buffer := strings.Builder{}
+	for _, token := range tokens {
+		switch token.kind {
+		case staticNode:
+			buffer.WriteString(token.value)
+		case paramNode:
+			buffer.WriteString(":")
+			if token.constraint != nil {
+				buffer.WriteString("<" + token.constraint.expr + ">")
+			}
+		case wildcardNode:
+			buffer.WriteString("*")
+		case catchAllNode:
+			buffer.WriteString("**")
+		}
+	}
+	return buffer.String()
+}
+
+func commonPrefix(a, b string) int {
+	max := len(a)
+	if len(b) < max {
+		max = len(b)
+	}
+	i := 0
+	for i < max && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func (n *node) insert(tokens []token) *node {
+	current := n
+	for _, token := range tokens {
+		switch token.kind {
+		case staticNode:
+			current = current.insertStatic(token.value)
+		case paramNode:
+			current = current.insertParam(token.value, token.constraint)
+		case wildcardNode:
+			if current.wildcard == nil {
+				current.wildcard = &node{kind: wildcardNode}
+			}
+			current = current.wildcard
+		case catchAllNode:
+			if current.catchAll == nil {
+				current.catchAll = &node{kind: catchAllNode, name: token.value}
+			}
+			current = current.catchAll
+		}
+	}
+	return current
+}
+
+func (n *node) insertStatic(path string) *node {
+	current := n
+	for len(path) > 0 {
+		index := strings.IndexByte(current.indices, path[0])
+		if index < 0 {
+			child := &node{kind: staticNode, path: path}
+			current.indices += path[:1]
+			current.children = append(current.children, child)
+			return child
+		}
+		child := current.children[index]
+		length := commonPrefix(child.path, path)
+		if length < len(child.path) {
+			split := new(node)
+			*split = *child
+			split.path = child.path[length:]
+			*child = node{
+				kind:     staticNode,
+				path:     child.path[:length],
+				indices:  split.path[:1],
+				children: []*node{split},
+			}
+		}
+		path = path[length:]
+		current = child
+	}
+	return current
+}
+
+// insertParam keeps constrained parameters ahead of unconstrained ones so the
+// more specific candidates are always tried first.
+func (n *node) insertParam(name string, constraint *constraint) *node {
+	index := len(n.params)
+	for i, child := range n.params {
+		if child.name == name && child.constraint.String() == constraint.String() {
+			return child
+		}
+		if constraint != nil && child.constraint == nil && i < index {
+			index = i
+		}
+	}
+	child := &node{kind: paramNode, name: name, constraint: constraint}
+	n.params = append(n.params, nil)
+	copy(n.params[index+1:], n.params[index:])
+	n.params[index] = child
+	return child
+}
+
+func (n *node) addEndpoint(endpoint *endpoint) {
+	n.endpoints = append(n.endpoints, endpoint)
+}
+
+// endpoint resolves the handler registered for method. HEAD requests fall back
+// to the GET handler unless it has opted out of automatic HEAD handling.
+func (n *node) endpoint(method string) *endpoint {
+	for _, endpoint := range n.endpoints {
+		if method == "*" || endpoint.method == method {
+			return endpoint
+		}
+	}
+	if method == http.MethodHead {
+		for _, endpoint := range n.endpoints {
+			if endpoint.method == http.MethodGet && endpoint.autoHead {
+				return endpoint
+			}
+		}
+	}
+	return nil
+}
+
+// lookup walks the tree depth first. Static children are always tried before
+// parameters, parameters before single segment wildcards and those before
+// catch-all segments. A failed branch backtracks so that a less specific route
+// registered for the requested method can still match.
+func (n *node) lookup(path string, method string, params *[]param) *endpoint {
+	length := len(*params)
+	switch n.kind {
+	case staticNode:
+		if len(path) < len(n.path) || path[:len(n.path)] != n.path {
+			return nil
+		}
+		path = path[len(n.path):]
+	case paramNode, wildcardNode:
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end == 0 {
+			return nil
+		}
+		if n.kind == paramNode {
+			var value any = path[:end]
+			if n.constraint != nil {
+				output, ok := n.constraint.match(path[:end])
+				if !ok {
+					return nil
+				}
+				value = output
+			}
+			*params = append(*params, param{key: n.name, value: value})
+		}
+		path = path[end:]
+	case catchAllNode:
+		if len(path) == 0 {
+			return nil
+		}
+		endpoint := n.endpoint(method)
+		if endpoint != nil {
+			*params = append(*params, param{key: n.name, value: path})
+		}
+		return endpoint
+	}
+	if len(path) == 0 {
+		if endpoint := n.endpoint(method); endpoint != nil {
+			return endpoint
+		}
+		*params = (*params)[:length]
+		return nil
+	}
+	if index := strings.IndexByte(n.indices, path[0]); index >= 0 {
+		if endpoint := n.children[index].lookup(path, method, params); endpoint != nil {
+			return endpoint
+		}
+	}
+	for _, child := range n.params {
+		if endpoint := child.lookup(path, method, params); endpoint != nil {
+			return endpoint
+		}
+	}
+	if n.wildcard != nil {
+		if endpoint := n.wildcard.lookup(path, method, params); endpoint != nil {
+			return endpoint
+		}
+	}
+	if n.catchAll != nil {
+		if endpoint := n.catchAll.lookup(path, method, params); endpoint != nil {
+			return endpoint
+		}
+	}
+	*params = (*params)[:length]
+	return nil
+}
+
+// walk calls fn for every node that consumes the whole path, regardless of the
+// methods registered on it.
+func (n *node) walk(path string, fn func(*node)) {
+	switch n.kind {
+	case staticNode:
+		if len(path) < len(n.path) || path[:len(n.path)] != n.path {
+			return
+		}
+		path = path[len(n.path):]
+	case paramNode, wildcardNode:
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end == 0 {
+			return
+		}
+		if n.constraint != nil {
+			if _, ok := n.constraint.match(path[:end]); !ok {
+				return
+			}
+		}
+		path = path[end:]
+	case catchAllNode:
+		if len(path) != 0 {
+			fn(n)
+		}
+		return
+	}
+	if len(path) == 0 {
+		fn(n)
+		return
+	}
+	if index := strings.IndexByte(n.indices, path[0]); index >= 0 {
+		n.children[index].walk(path, fn)
+	}
+	for _, child := range n.params {
+		child.walk(path, fn)
+	}
+	if n.wildcard != nil {
+		n.wildcard.walk(path, fn)
+	}
+	if n.catchAll != nil {
+		n.catchAll.walk(path, fn)
+	}
+}
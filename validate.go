@@ -0,0 +1,261 @@
+package gtw
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type (
+	FieldError struct {
+		Pointer string `json:"pointer"`
+		Rule    string `json:"rule"`
+		Detail  string `json:"detail"`
+	}
+	ValidationErrors []*FieldError
+	rule             struct {
+		name  string
+		check func(value reflect.Value) (string, bool)
+	}
+)
+
+var (
+	_rules sync.Map
+)
+
+func (validationErrors ValidationErrors) Error() string {
+	messages := make([]string, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		messages = append(messages, fmt.Sprintf("%s %s", fieldError.Pointer, fieldError.Detail))
+	}
+	return fmt.Sprintf("validation failed: %s", strings.Join(messages, "; "))
+}
+
+// Validate checks v, a pointer to a struct, against the `validate` tags of its
+// fields and of any nested structs, slices and maps. Every failing rule is
+// collected into the returned ValidationErrors, each addressed by a JSON
+// pointer built from the `json` names of the fields.
+//
+// Supported rules are required, min=N, max=N, email, oneof=a b c and
+// regex=pattern. Because rules are comma separated, regex must be the last
+// rule of a tag. Apart from required, rules are skipped for nil pointers and
+// empty strings, slices and maps; numbers are checked even when they are zero.
+func Validate(v any) error {
+	validationErrors := make(ValidationErrors, 0)
+	if err := validate(reflect.ValueOf(v), "", &validationErrors); err != nil {
+		return err
+	}
+	if len(validationErrors) == 0 {
+		return nil
+	}
+	return validationErrors
+}
+
+func validate(value reflect.Value, pointer string, validationErrors *ValidationErrors) error {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		t := value.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			path := fmt.Sprintf("%s/%s", pointer, escapePointer(jsonName(field)))
+			if tag, ok := field.Tag.Lookup("validate"); ok {
+				rules, err := parseRules(tag)
+				if err != nil {
+					return fmt.Errorf("%s.%s: %w", t.String(), field.Name, err)
+				}
+				for _, rule := range rules {
+					if detail, ok := rule.check(value.Field(i)); !ok {
+						*validationErrors = append(*validationErrors, &FieldError{Pointer: path, Rule: rule.name, Detail: detail})
+					}
+				}
+			}
+			if err := validate(value.Field(i), path, validationErrors); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := validate(value.Index(i), fmt.Sprintf("%s/%d", pointer, i), validationErrors); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			if err := validate(iter.Value(), fmt.Sprintf("%s/%s", pointer, escapePointer(fmt.Sprint(iter.Key().Interface()))), validationErrors); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func parseRules(tag string) ([]*rule, error) {
+	if rules, ok := _rules.Load(tag); ok {
+		return rules.([]*rule), nil
+	}
+	key := tag
+	rules := make([]*rule, 0)
+	for len(tag) != 0 {
+		var item string
+		if strings.HasPrefix(tag, "regex=") {
+			item, tag = tag, ""
+		} else if index := strings.IndexByte(tag, ','); index >= 0 {
+			item, tag = tag[:index], tag[index+1:]
+		} else {
+			item, tag = tag, ""
+		}
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		name, param, _ := strings.Cut(item, "=")
+		rule, err := newRule(name, param)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	_rules.Store(key, rules)
+	return rules, nil
+}
+
+func newRule(name string, param string) (*rule, error) {
+	rule := &rule{name: name}
+	switch name {
+	case "required":
+		rule.check = func(value reflect.Value) (string, bool) {
+			return "is required", !isEmpty(value)
+		}
+		return rule, nil
+	case "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid `%s` rule parameter `%s`", name, param)
+		}
+		rule.check = optional(func(value reflect.Value) (string, bool) {
+			size, isLength := sizeOf(value)
+			ok := size >= limit
+			if name == "max" {
+				ok = size <= limit
+			}
+			if ok {
+				return "", true
+			}
+			comparison := "at least"
+			if name == "max" {
+				comparison = "at most"
+			}
+			if isLength {
+				return fmt.Sprintf("must have a length of %s %s", comparison, param), false
+			}
+			return fmt.Sprintf("must be %s %s", comparison, param), false
+		})
+		return rule, nil
+	case "email":
+		rule.check = optional(func(value reflect.Value) (string, bool) {
+			address, err := mail.ParseAddress(fmt.Sprint(value.Interface()))
+			return "must be a valid email address", err == nil && address.Address == fmt.Sprint(value.Interface())
+		})
+		return rule, nil
+	case "oneof":
+		options := strings.Fields(param)
+		rule.check = optional(func(value reflect.Value) (string, bool) {
+			text := fmt.Sprint(value.Interface())
+			for _, option := range options {
+				if option == text {
+					return "", true
+				}
+			}
+			return fmt.Sprintf("must be one of %s", strings.Join(options, ", ")), false
+		})
+		return rule, nil
+	case "regex":
+		regex, err := regexp.Compile(param)
+		if err != nil {
+			return nil, fmt.Errorf("invalid `regex` rule parameter: %w", err)
+		}
+		rule.check = optional(func(value reflect.Value) (string, bool) {
+			return fmt.Sprintf("must match %s", param), regex.MatchString(fmt.Sprint(value.Interface()))
+		})
+		return rule, nil
+	}
+	return nil, fmt.Errorf("unknown validation rule `%s`", name)
+}
+
+// optional skips check for unset values so that only `required` rejects them.
+func optional(check func(value reflect.Value) (string, bool)) func(value reflect.Value) (string, bool) {
+	return func(value reflect.Value) (string, bool) {
+		if isUnset(value) {
+			return "", true
+		}
+		for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+			value = value.Elem()
+		}
+		return check(value)
+	}
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return value.IsNil()
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+// isUnset reports whether value is a nil pointer or an empty string, slice or
+// map. Unlike isEmpty it treats zero numbers and false as real values.
+func isUnset(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return value.IsNil()
+	case reflect.Slice, reflect.Map, reflect.String:
+		return value.Len() == 0
+	}
+	return false
+}
+
+func sizeOf(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), false
+	}
+	return 0, false
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if len(name) != 0 && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
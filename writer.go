@@ -0,0 +1,112 @@
+package gtw
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+type (
+	headWriter struct {
+		http.ResponseWriter
+		status  int
+		written int
+	}
+)
+
+func (w *headWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *headWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.written += len(b)
+	return len(b), nil
+}
+
+// flush sends the headers captured while the GET handler ran. The body is
+// discarded but its length is still reported unless the handler set one.
+func (w *headWriter) flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.written != 0 && len(w.Header().Get("Content-Length")) == 0 {
+		w.Header().Set("Content-Length", strconv.Itoa(w.written))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// responseWriter wraps the writer handed to handlers by Server so the
+// framework knows whether a response has already been started. It keeps the
+// optional http.Flusher and http.Hijacker capabilities of the wrapped writer.
+type responseWriter struct {
+	http.ResponseWriter
+	request *http.Request
+	server  *Server
+	status  int
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", w.ResponseWriter)
+	}
+	w.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) started() bool {
+	return w.status != 0
+}
+
+func (w *headWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// unwrap finds the responseWriter installed by Server underneath any other
+// writer wrapping it.
+func unwrap(w http.ResponseWriter) (*responseWriter, bool) {
+	for {
+		switch writer := w.(type) {
+		case *responseWriter:
+			return writer, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}